@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 // A Build is a build's data from the undocumented Concourse API.
@@ -19,6 +20,42 @@ type Build struct {
 	InstanceVars map[string]any `json:"pipeline_instance_vars,omitempty"`
 	StartTime    int            `json:"start_time"`
 	EndTime      int            `json:"end_time"`
+	CreatedBy    string         `json:"created_by,omitempty"`
+}
+
+// Started returns when the build started, or the zero time if it has not.
+func (b *Build) Started() time.Time {
+	if b.StartTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(b.StartTime), 0)
+}
+
+// Ended returns when the build ended, or the zero time if it has not.
+func (b *Build) Ended() time.Time {
+	if b.EndTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(b.EndTime), 0)
+}
+
+// Duration returns how long the build ran, or has been running if it has not
+// ended yet. It is 0 if the build has not started.
+func (b *Build) Duration() time.Duration {
+	return b.DurationAt(time.Now())
+}
+
+// DurationAt returns how long the build ran, or had been running at now if it
+// has not ended yet. It is 0 if the build has not started.
+func (b *Build) DurationAt(now time.Time) time.Duration {
+	if b.StartTime == 0 {
+		return 0
+	}
+	end := b.Ended()
+	if end.IsZero() {
+		end = now
+	}
+	return end.Sub(b.Started()).Truncate(time.Second)
 }
 
 // BuildMetadata is the current build's metadata exposed via the environment.
@@ -32,6 +69,7 @@ type BuildMetadata struct {
 	JobName      string
 	BuildName    string
 	URL          string
+	CreatedBy    string // User who triggered the build manually, if exposed
 }
 
 // NewBuildMetadata returns a populated BuildMetadata.
@@ -49,6 +87,7 @@ func NewBuildMetadata(atcurl string) BuildMetadata {
 		JobName:      os.Getenv("BUILD_JOB_NAME"),
 		BuildName:    os.Getenv("BUILD_NAME"),
 		InstanceVars: os.Getenv("BUILD_PIPELINE_INSTANCE_VARS"),
+		CreatedBy:    os.Getenv("BUILD_CREATED_BY"),
 	}
 
 	instanceVarsQuery := ""
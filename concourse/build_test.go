@@ -3,6 +3,7 @@ package concourse
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -19,6 +20,7 @@ func TestNewBuildMetadata(t *testing.T) {
 	cases := map[string]struct {
 		host         string
 		instanceVars string
+		createdBy    string
 		want         BuildMetadata
 	}{
 		"environment only": {
@@ -44,6 +46,19 @@ func TestNewBuildMetadata(t *testing.T) {
 				URL:          "https://example.com/teams/main/pipelines/demo/jobs/my%20test/builds/1",
 			},
 		},
+		"created by": {
+			createdBy: "alice",
+			want: BuildMetadata{
+				Host:         "https://ci.example.com",
+				TeamName:     "main",
+				PipelineName: "demo",
+				InstanceVars: "",
+				JobName:      "my test",
+				BuildName:    "1",
+				URL:          "https://ci.example.com/teams/main/pipelines/demo/jobs/my%20test/builds/1",
+				CreatedBy:    "alice",
+			},
+		},
 		"url with instance vars": {
 			instanceVars: `{"image_name":"my-image","pr_number":1234,"args":["start"]}`,
 			want: BuildMetadata{
@@ -68,6 +83,11 @@ func TestNewBuildMetadata(t *testing.T) {
 			} else {
 				os.Unsetenv("BUILD_PIPELINE_INSTANCE_VARS")
 			}
+			if c.createdBy != "" {
+				os.Setenv("BUILD_CREATED_BY", c.createdBy)
+			} else {
+				os.Unsetenv("BUILD_CREATED_BY")
+			}
 
 			metadata := NewBuildMetadata(c.host)
 			if !cmp.Equal(metadata, c.want) {
@@ -76,3 +96,32 @@ func TestNewBuildMetadata(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildDuration(t *testing.T) {
+	cases := map[string]struct {
+		build *Build
+		want  time.Duration
+	}{
+		"not started": {
+			build: &Build{},
+			want:  0,
+		},
+		"ended": {
+			build: &Build{StartTime: 1792231200, EndTime: 1792231200 + 95},
+			want:  95 * time.Second,
+		},
+		"running": {
+			build: &Build{StartTime: 1792231200},
+			want:  time.Minute,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := c.build.DurationAt(time.Unix(1792231200+60, 500))
+			if got != c.want {
+				t.Fatalf("unexpected duration from DurationAt:\n\t(GOT): %s\n\t(WNT): %s", got, c.want)
+			}
+		})
+	}
+}
@@ -9,17 +9,28 @@ import (
 	"net/http/cookiejar"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"golang.org/x/oauth2"
 )
 
+// requestTimeout is how long a single request to Concourse may take, so
+// alerts are not held up by an unreachable Concourse API.
+const requestTimeout = 10 * time.Second
+
+// maxPageSize is the most builds requested from Concourse at once.
+const maxPageSize = 100
+
 // A Client is a Concourse API connection.
 type Client struct {
 	atcurl *url.URL
 	team   string
 
 	conn *http.Client
+	// secrets are removed from all errors returned by the Client.
+	secrets []string
 }
 
 // Info is version information from the Concourse API.
@@ -35,10 +46,11 @@ type Token struct {
 }
 
 // NewClient returns an authorized Client (if private) for the Concourse API.
+// The password and access tokens are redacted from the returned errors.
 func NewClient(atcurl, team, username, password string) (*Client, error) {
 	u, err := url.Parse(atcurl)
 	if err != nil {
-		return nil, err
+		return nil, Redact(err, password, atcurl)
 	}
 	// This cookie jar implementation never returns an error.
 	jar, _ := cookiejar.New(nil)
@@ -47,44 +59,63 @@ func NewClient(atcurl, team, username, password string) (*Client, error) {
 		atcurl: u,
 		team:   team,
 
-		conn: &http.Client{Jar: jar},
+		conn:    &http.Client{Jar: jar, Timeout: requestTimeout},
+		secrets: []string{password},
+	}
+	if p, ok := u.User.Password(); ok {
+		c.secrets = append(c.secrets, p)
 	}
 
-	// Return Client early if authorization is not needed.
+	err = c.authorize(username, password)
+	if err != nil {
+		return nil, c.redact(err)
+	}
+	return c, nil
+}
+
+// redact removes the password and access tokens of the Client from err.
+func (c *Client) redact(err error) error {
+	return Redact(err, c.secrets...)
+}
+
+// authorize logs into Concourse, if the username or password are set, with
+// the method supported by its version.
+func (c *Client) authorize(username, password string) error {
+	// Return early if authorization is not needed.
 	if username == "" && password == "" {
-		return c, nil
+		return nil
 	}
 
 	info, err := c.info()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	legacy, err := semver.NewConstraint("< 4.0.0")
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	v, err := semver.NewVersion(info.ATCVersion)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	multiCookie, err := semver.NewConstraint("5.5 - 6.4")
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	oldsky, err := semver.NewConstraint("< 6.1.0")
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Check if target Concourse is less than '4.0.0'.
 	if legacy.Check(v) {
 		url := fmt.Sprintf("%s/api/v1/teams/%s/auth/token", c.atcurl, c.team)
 		err = c.loginLegacy(url, username, password)
-		return c, err
+		return err
 	}
 
 	url := fmt.Sprintf("%s/sky/issuer/token", c.atcurl)
@@ -95,29 +126,29 @@ func NewClient(atcurl, team, username, password string) (*Client, error) {
 
 	token, err := c.login(url, username, password)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Check if the version supports single cookie access tokens.
 	// Single cookie is used between versions 4.0.0 - 5.5.0 and 6.5.0 or greater.
 	if !multiCookie.Check(v) {
 		err = c.singleCookie(token.TokenType, token.AccessToken)
-		return c, err
+		return err
 	}
 
 	// Check if the version is less than '6.1.0'.
 	if oldsky.Check(v) {
 		err = c.splitToken(token.TokenType, token.AccessToken)
-		return c, err
+		return err
 	}
 
 	idToken, ok := token.Extra("id_token").(string)
 	if !ok {
-		return c, errors.New("invalid id_token")
+		return errors.New("invalid id_token")
 	}
 
 	err = c.splitToken(token.TokenType, idToken)
-	return c, err
+	return err
 }
 
 // info queries Concourse for its version information.
@@ -139,6 +170,7 @@ func (c *Client) info() (Info, error) {
 
 // singleCookie add the token as a single cookie.
 func (c *Client) singleCookie(tokenType, tokenValue string) error {
+	c.secrets = append(c.secrets, tokenValue)
 	c.conn.Jar.SetCookies(
 		c.atcurl,
 		[]*http.Cookie{{
@@ -156,6 +188,7 @@ func (c *Client) splitToken(tokenType, tokenValue string) error {
 	const maxCookieSize = 4000
 
 	tokenStr := fmt.Sprintf("%s %s", tokenType, tokenValue)
+	c.secrets = append(c.secrets, tokenValue)
 
 	for i := 0; i < NumCookies; i++ {
 		if len(tokenStr) > maxCookieSize {
@@ -213,6 +246,7 @@ func (c *Client) loginLegacy(url, username, password string) error {
 
 	var t Token
 	json.NewDecoder(r.Body).Decode(&t)
+	c.secrets = append(c.secrets, t.Value)
 
 	c.conn.Jar.SetCookies(
 		c.atcurl,
@@ -224,22 +258,14 @@ func (c *Client) loginLegacy(url, username, password string) error {
 	return nil
 }
 
-// JobBuild finds and returns a Build from the Concourse API by its
-// pipeline name, job name and build name.
-func (c *Client) JobBuild(pipeline, job, name, instanceVars string) (*Build, error) {
-	u := fmt.Sprintf(
-		"%s/api/v1/teams/%s/pipelines/%s/jobs/%s/builds/%s%s",
-		c.atcurl,
-		c.team,
-		pipeline,
-		job,
-		name,
-		instanceVars,
-	)
+// Build returns a Build from the Concourse API by its ID, e.g. the current
+// build's BUILD_ID.
+func (c *Client) Build(id string) (*Build, error) {
+	u := fmt.Sprintf("%s/api/v1/builds/%s", c.atcurl, url.PathEscape(id))
 
 	r, err := c.conn.Get(u)
 	if err != nil {
-		return nil, err
+		return nil, c.redact(err)
 	}
 	if r.StatusCode != 200 {
 		return nil, fmt.Errorf("unexpected status code: %d", r.StatusCode)
@@ -249,3 +275,82 @@ func (c *Client) JobBuild(pipeline, job, name, instanceVars string) (*Build, err
 	json.NewDecoder(r.Body).Decode(&build)
 	return build, nil
 }
+
+// JobBuilds returns up to limit builds of a job from the Concourse API, most
+// recent first, following the pages of the API as needed. instanceVars are
+// the pipeline's instance vars as JSON, e.g. BUILD_PIPELINE_INSTANCE_VARS.
+func (c *Client) JobBuilds(pipeline, job, instanceVars string, limit int) ([]Build, error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(min(limit, maxPageSize)))
+	if instanceVars != "" {
+		q.Set("vars", instanceVars)
+	}
+	u, err := url.Parse(fmt.Sprintf(
+		"%s/api/v1/teams/%s/pipelines/%s/jobs/%s/builds",
+		c.atcurl,
+		url.PathEscape(c.team),
+		url.PathEscape(pipeline),
+		url.PathEscape(job),
+	))
+	if err != nil {
+		return nil, c.redact(err)
+	}
+	u.RawQuery = q.Encode()
+
+	var builds []Build
+	for len(builds) < limit {
+		r, err := c.conn.Get(u.String())
+		if err != nil {
+			return nil, c.redact(err)
+		}
+		if r.StatusCode != 200 {
+			r.Body.Close()
+			return nil, fmt.Errorf("unexpected status code: %d", r.StatusCode)
+		}
+
+		var page []Build
+		err = json.NewDecoder(r.Body).Decode(&page)
+		r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding builds: %w", err)
+		}
+		builds = append(builds, page...)
+
+		next := nextPage(r.Header)
+		if len(page) == 0 || next == nil {
+			break
+		}
+		// The next page is requested from the same URL, since the link is
+		// relative to Concourse's external URL, not concourse_url.
+		q := u.Query()
+		for k, v := range next {
+			q[k] = v
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	if len(builds) > limit {
+		builds = builds[:limit]
+	}
+	return builds, nil
+}
+
+// nextPage returns the query of the next page from the Link header of a
+// Concourse API response, e.g. <...?to=42&limit=100>; rel="next", or nil if
+// there is none.
+func nextPage(h http.Header) url.Values {
+	for _, header := range h.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+			if !ok || !strings.Contains(params, `rel="next"`) {
+				continue
+			}
+			u, err := url.Parse(strings.Trim(strings.TrimSpace(target), "<>"))
+			if err != nil {
+				return nil
+			}
+			return u.Query()
+		}
+	}
+	return nil
+}
@@ -144,70 +144,130 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
-func TestJobBuild(t *testing.T) {
+func TestNewClientRedacts(t *testing.T) {
+	const password = "sup3rs3cret1"
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.RequestURI {
+		case "/api/v1/info":
+			json.NewEncoder(w).Encode(Info{ATCVersion: "6.5.0"})
+		default:
+			http.Error(w, "invalid password "+r.FormValue("password"), http.StatusBadRequest)
+		}
+	}))
+	defer s.Close()
+
+	_, err := NewClient(s.URL, "main", "admin", password)
+	if err == nil {
+		t.Fatalf("expected an error from NewClient:\n\t(GOT): nil")
+	} else if strings.Contains(err.Error(), password) {
+		t.Fatalf("unexpected password in error from NewClient:\n\t(ERR): %s", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	want := &Build{
+		ID:        42,
+		Team:      "main",
+		Name:      "3",
+		Status:    "started",
+		Job:       "test",
+		APIURL:    "/api/v1/builds/42",
+		Pipeline:  "demo",
+		StartTime: 1792231200,
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/builds/42" {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+		resp, _ := json.Marshal(want)
+		w.Write(resp)
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	client := &Client{atcurl: u, team: "main", conn: &http.Client{}}
+
+	build, err := client.Build("42")
+	if err != nil {
+		t.Fatalf("unexpected error from Build:\n\t(ERR): %s", err)
+	} else if !cmp.Equal(build, want) {
+		t.Fatalf("unexpected Build from Build:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", build, want, cmp.Diff(build, want))
+	}
+
+	_, err = client.Build("43")
+	if err == nil {
+		t.Fatalf("expected an error from Build:\n\t(GOT): nil")
+	}
+}
+
+func TestJobBuilds(t *testing.T) {
+	var all []Build
+	for id := 5; id > 0; id-- {
+		all = append(all, Build{ID: id, Name: fmt.Sprint(id), Status: "succeeded", Job: "test", Pipeline: "demo"})
+	}
+
+	// The server returns pages of 2 builds, linked like Concourse does.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/teams/main/pipelines/demo/jobs/test/builds" || r.URL.Query().Get("vars") != `{"env":"prod"}` {
+			http.Error(w, "", http.StatusNotFound)
+			return
+		}
+
+		to := len(all)
+		fmt.Sscan(r.URL.Query().Get("to"), &to)
+		start := len(all) - to
+		page := all[start:min(start+2, len(all))]
+		if last := start + len(page); last < len(all) {
+			w.Header().Set("Link", fmt.Sprintf(`<https://ci.example.com%s?to=%d&limit=2>; rel="next"`, r.URL.Path, all[last].ID))
+		}
+		resp, _ := json.Marshal(page)
+		w.Write(resp)
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+
 	cases := map[string]struct {
-		build *Build
+		job   string
+		limit int
+		want  []Build
 		err   bool
 	}{
-		"basic": {build: &Build{
-			ID:       1,
-			Team:     "main",
-			Name:     "1",
-			Status:   "succeeded",
-			Job:      "test",
-			APIURL:   "/api/v1/builds/1",
-			Pipeline: "demo",
-		}},
-		"instance vars": {build: &Build{
-			ID:       1,
-			Team:     "main",
-			Name:     "1",
-			Status:   "succeeded",
-			Job:      "test",
-			APIURL:   "/api/v1/builds/1",
-			Pipeline: "demo",
-			InstanceVars: map[string]any{
-				"image_name": "my-image",
-				// Go parses numbers as float64 by default
-				"pr_number": float64(1234),
-				"args":      []any{"start"},
-			},
-		}},
-		"unauthorized": {
-			build: &Build{},
+		"one page": {
+			job:   "test",
+			limit: 2,
+			want:  all[:2],
+		},
+		"pages": {
+			job:   "test",
+			limit: 3,
+			want:  all[:3],
+		},
+		"all": {
+			job:   "test",
+			limit: 10,
+			want:  all,
+		},
+		"not found": {
+			job:   "other",
+			limit: 10,
 			err:   true,
 		},
 	}
 
 	for name, c := range cases {
-		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if c.err {
-				http.Error(w, "", http.StatusUnauthorized)
-			}
-			resp, _ := json.Marshal(c.build)
-			w.Write(resp)
-		}))
-		u, _ := url.Parse(s.URL)
-
 		t.Run(name, func(t *testing.T) {
-			client := &Client{atcurl: u, team: c.build.Team, conn: &http.Client{}}
-			instanceVarsQuery := ""
-
-			if c.build.InstanceVars != nil {
-				varsBytes, _ := json.Marshal(c.build.InstanceVars)
-				instanceVarsQuery = fmt.Sprintf("?vars=%s", url.QueryEscape(string(varsBytes)))
-			}
-
-			build, err := client.JobBuild(c.build.Pipeline, c.build.Job, c.build.Name, instanceVarsQuery)
+			client := &Client{atcurl: u, team: "main", conn: &http.Client{}}
 
+			builds, err := client.JobBuilds("demo", c.job, `{"env":"prod"}`, c.limit)
 			if err != nil && !c.err {
-				t.Fatalf("unexpected error from JobBuild:\n\t(ERR): %s", err)
+				t.Fatalf("unexpected error from JobBuilds:\n\t(ERR): %s", err)
 			} else if err == nil && c.err {
-				t.Fatalf("expected an error from JobBuild:\n\t(GOT): nil")
-			} else if !c.err && !cmp.Equal(build, c.build) {
-				t.Fatalf("unexpected Build from JobBuild:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", build, c.build, cmp.Diff(build, c.build))
+				t.Fatalf("expected an error from JobBuilds:\n\t(GOT): nil")
+			} else if !cmp.Equal(builds, c.want) {
+				t.Fatalf("unexpected Builds from JobBuilds:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", builds, c.want, cmp.Diff(builds, c.want))
 			}
 		})
-		s.Close()
 	}
 }
@@ -0,0 +1,46 @@
+package concourse
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces secrets in errors.
+const Redacted = "REDACTED"
+
+// A redactedError is an error with secrets removed from its message.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Redact returns err with every occurrence of the secrets, also URL-encoded,
+// replaced by Redacted. Blank secrets are ignored.
+func Redact(err error, secrets ...string) error {
+	if err == nil {
+		return nil
+	}
+
+	var pairs []string
+	for _, s := range secrets {
+		if s == "" {
+			continue
+		}
+		pairs = append(pairs, s, Redacted)
+		if escaped := url.QueryEscape(s); escaped != s {
+			pairs = append(pairs, escaped, Redacted)
+		}
+	}
+
+	msg := err.Error()
+	if len(pairs) > 0 {
+		msg = strings.NewReplacer(pairs...).Replace(msg)
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
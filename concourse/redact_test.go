@@ -0,0 +1,47 @@
+package concourse
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	base := errors.New("base")
+
+	cases := map[string]struct {
+		err     error
+		secrets []string
+		want    string
+	}{
+		"nothing to redact": {
+			err:     fmt.Errorf("status code 401: %w", base),
+			secrets: []string{"sup3rs3cret1", ""},
+			want:    "status code 401: base",
+		},
+		"secret": {
+			err:     fmt.Errorf("Post \"https://discord.com/api/webhooks/1/t0ken\": EOF: %w", base),
+			secrets: []string{"https://discord.com/api/webhooks/1/t0ken", "t0ken"},
+			want:    "Post \"REDACTED\": EOF: base",
+		},
+		"escaped secret": {
+			err:     fmt.Errorf("bad request password=p%%40ss+word: %w", base),
+			secrets: []string{"p@ss word"},
+			want:    "bad request password=REDACTED: base",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := Redact(c.err, c.secrets...)
+			if got.Error() != c.want {
+				t.Fatalf("unexpected error from Redact:\n\t(GOT): %s\n\t(WNT): %s", got, c.want)
+			} else if !errors.Is(got, base) {
+				t.Fatalf("error from Redact does not wrap the original error")
+			}
+		})
+	}
+	if Redact(nil, "secret") != nil {
+		t.Fatalf("expected nil from Redact of nil")
+	}
+}
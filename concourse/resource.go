@@ -1,5 +1,12 @@
 package concourse
 
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
 // A Source is the resource's source configuration.
 type Source struct {
 	URL          string `json:"url"`
@@ -7,6 +14,70 @@ type Source struct {
 	Password     string `json:"password"`
 	ConcourseURL string `json:"concourse_url"`
 	Disable      bool   `json:"disable"`
+
+	// DiscordUsername is the name alerts are sent with, since username is the
+	// Concourse user.
+	DiscordUsername string `json:"discord_username"`
+	AvatarURL       string `json:"avatar_url"`
+	Icons           string `json:"icons"`         // attach or url
+	IconBaseURL     string `json:"icon_base_url"` // Defaults to $ATC_EXTERNAL_URL/public/images
+
+	URLs     []WebhookURL `json:"urls"`     // Further webhooks to alert
+	Delivery string       `json:"delivery"` // all or any webhooks must succeed
+
+	ThreadID    string              `json:"thread_id"`
+	ThreadName  string              `json:"thread_name"`
+	AppliedTags map[string][]string `json:"applied_tags"` // Forum tag IDs by alert type
+
+	AlertTypes map[string]AlertType `json:"alert_types"` // New or overridden alert types by name
+
+	// SkipStatuses are the statuses of previous builds which fixed and broke
+	// skip. Defaults to aborted and errored.
+	SkipStatuses []string `json:"skip_statuses"`
+
+	DiscordUsers map[string]string `json:"discord_users"` // Discord user IDs by Concourse user
+
+	Flaky *FlakyPolicy `json:"flaky"` // Detects flaky jobs if set
+}
+
+// An AlertType defines a new alert type or overrides a built-in one. Unset
+// values keep those of the built-in type.
+type AlertType struct {
+	Color     string   `json:"color"`
+	IconURL   string   `json:"icon_url"`
+	Message   string   `json:"message"`
+	Roles     []string `json:"roles"` // Roles to mention
+	Users     []string `json:"users"` // Users to mention
+	Username  string   `json:"username"`
+	AvatarURL string   `json:"avatar_url"`
+
+	MentionCreatedBy bool          `json:"mention_created_by"` // Mention who triggered the build
+	AlertOnStreak    *StreakPolicy `json:"alert_on_streak"`
+}
+
+// A WebhookURL is a webhook of urls, given either as its URL or as an object
+// with a url and a label.
+type WebhookURL struct {
+	URL   string `json:"url"`
+	Label string `json:"label"`
+}
+
+func (u *WebhookURL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*u = WebhookURL{URL: s}
+		return nil
+	}
+
+	type webhookURL WebhookURL
+	return json.Unmarshal(data, (*webhookURL)(u))
+}
+
+// A Field is an embed field of an alert.
+type Field struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
 }
 
 // Metadata are a key-value pair that must be included for in the in and out
@@ -22,22 +93,137 @@ type Version map[string]string
 // CheckResponse is the output for the check operation.
 type CheckResponse []Version
 
+// InRequest is the input for the in operation.
+type InRequest struct {
+	Source  Source  `json:"source"`
+	Version Version `json:"version"`
+}
+
 // InResponse is the output for the in operation.
 type InResponse struct {
 	Version  Version    `json:"version"`
 	Metadata []Metadata `json:"metadata"`
 }
 
+// A StreakPolicy is when alerts of repeated results are sent, given either
+// as the list of its at or as an object, e.g. {at: [1, 2, 5, 10], every: 10}
+// alerts on the 1st, 2nd, 5th and 10th build of a streak, then every 10th.
+type StreakPolicy struct {
+	At    []int `json:"at"`
+	Every int   `json:"every"`
+}
+
+func (p *StreakPolicy) UnmarshalJSON(data []byte) error {
+	var at []int
+	if err := json.Unmarshal(data, &at); err == nil {
+		*p = StreakPolicy{At: at}
+		return nil
+	}
+
+	type streakPolicy StreakPolicy
+	return json.Unmarshal(data, (*streakPolicy)(p))
+}
+
+// Alerts returns whether the count-th build of a streak is alerted on.
+func (p StreakPolicy) Alerts(count int) bool {
+	if slices.Contains(p.At, count) {
+		return true
+	}
+	return p.Every > 0 && count > slices.Max(append([]int{0}, p.At...)) && count%p.Every == 0
+}
+
+// String describes the policy, e.g. "1, 2, 5, 10, then every 10th".
+func (p StreakPolicy) String() string {
+	var at []string
+	for _, n := range p.At {
+		at = append(at, fmt.Sprint(n))
+	}
+	s := strings.Join(at, ", ")
+	if p.Every > 0 {
+		if s != "" {
+			s += ", then "
+		}
+		if p.Every == 1 {
+			s += "every build"
+		} else {
+			s += fmt.Sprintf("every %s", ordinal(p.Every))
+		}
+	}
+	return s
+}
+
+// ordinal returns n as an ordinal number, e.g. 10th.
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// A FlakyPolicy is when a job is flaky, from how often its recent builds
+// changed between succeeded and failed, and how its failures are alerted
+// then.
+type FlakyPolicy struct {
+	Builds int     `json:"builds"` // Finished builds looked at
+	Ratio  float64 `json:"ratio"`  // Least share of them which changed result
+
+	Color string       `json:"color"`
+	Roles []string     `json:"roles"` // Replace the mentions of the alert
+	Users []string     `json:"users"`
+	URLs  []WebhookURL `json:"urls"` // Replace the webhooks of the source
+}
+
 // OutParams are the parameters that can be configured for the out operation.
 type OutParams struct {
-	AlertType   string `json:"alert_type"`
-	Color       string `json:"color"`
-	Message     string `json:"message"`
-	MessageFile string `json:"message_file"`
-	Text        string `json:"text"`
-	TextFile    string `json:"text_file"`
-	Disable     bool   `json:"disable"`
-	Role        string `json:"role"`
+	AlertType   string   `json:"alert_type"`
+	Color       string   `json:"color"`
+	Message     string   `json:"message"`
+	MessageFile string   `json:"message_file"`
+	Text        string   `json:"text"`
+	TextFile    string   `json:"text_file"`
+	Description string   `json:"description"`
+	Username    string   `json:"username"`
+	AvatarURL   string   `json:"avatar_url"`
+	Disable     bool     `json:"disable"`
+	Role        string   `json:"role"`
+	Roles       []string `json:"roles"`
+	Users       []string `json:"users"`
+	Everyone    bool     `json:"everyone"`
+	Here        bool     `json:"here"`
+	Attachments []string `json:"attachments"`
+	Overflow    string   `json:"overflow"`
+
+	MentionCreatedBy bool `json:"mention_created_by"`
+
+	// AlertOnStreak throttles alerts of repeated results.
+	AlertOnStreak *StreakPolicy `json:"alert_on_streak"`
+
+	// Slow alerts are only sent if the build took longer than SlowThreshold
+	// times the SlowBaseline (p50 or p90) of the job's last SlowBuilds
+	// successful builds.
+	SlowThreshold float64 `json:"slow_threshold"`
+	SlowBaseline  string  `json:"slow_baseline"`
+	SlowBuilds    int     `json:"slow_builds"`
+
+	Fields        []Field `json:"fields"`
+	FieldsFile    string  `json:"fields_file"`
+	ReplaceFields bool    `json:"replace_fields"` // Replace instead of append to the default fields
+
+	PayloadFile string `json:"payload_file"`
+
+	UpdateMessageFile string `json:"update_message_file"`
+	DeleteMessage     string `json:"delete_message"`
+
+	ThreadID    string   `json:"thread_id"`
+	ThreadName  string   `json:"thread_name"`
+	AppliedTags []string `json:"applied_tags"`
 }
 
 // OutRequest is in the input for the out operation.
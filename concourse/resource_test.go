@@ -0,0 +1,86 @@
+package concourse
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWebhookURLUnmarshal(t *testing.T) {
+	data := `{"urls": ["https://discord.com/api/webhooks/1/a", {"url": "https://discord.com/api/webhooks/2/b", "label": "ops"}]}`
+	want := []WebhookURL{
+		{URL: "https://discord.com/api/webhooks/1/a"},
+		{URL: "https://discord.com/api/webhooks/2/b", Label: "ops"},
+	}
+
+	var got Source
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("unexpected error from json.Unmarshal:\n\t(ERR): %s", err)
+	}
+	if !cmp.Equal(got.URLs, want) {
+		t.Fatalf("unexpected urls from json.Unmarshal:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got.URLs, want, cmp.Diff(got.URLs, want))
+	}
+}
+
+func TestStreakPolicyUnmarshal(t *testing.T) {
+	data := `[[1, 2, 5], {"at": [1], "every": 10}]`
+	want := []StreakPolicy{
+		{At: []int{1, 2, 5}},
+		{At: []int{1}, Every: 10},
+	}
+
+	var got []StreakPolicy
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("unexpected error from json.Unmarshal:\n\t(ERR): %s", err)
+	}
+	if !cmp.Equal(got, want) {
+		t.Fatalf("unexpected policies from json.Unmarshal:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, want, cmp.Diff(got, want))
+	}
+}
+
+func TestStreakPolicy(t *testing.T) {
+	cases := map[string]struct {
+		policy StreakPolicy
+		alerts []int
+		want   string
+	}{
+		"at": {
+			policy: StreakPolicy{At: []int{2, 5}},
+			alerts: []int{2, 5},
+			want:   "2, 5",
+		},
+		"at then every": {
+			policy: StreakPolicy{At: []int{1, 2, 5}, Every: 4},
+			alerts: []int{1, 2, 5, 8, 12},
+			want:   "1, 2, 5, then every 4th",
+		},
+		"every": {
+			policy: StreakPolicy{Every: 3},
+			alerts: []int{3, 6, 9, 12},
+			want:   "every 3rd",
+		},
+		"every build": {
+			policy: StreakPolicy{Every: 1},
+			alerts: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+			want:   "every build",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var alerts []int
+			for count := 1; count <= 12; count++ {
+				if c.policy.Alerts(count) {
+					alerts = append(alerts, count)
+				}
+			}
+			if !cmp.Equal(alerts, c.alerts) {
+				t.Fatalf("unexpected alerts from StreakPolicy.Alerts:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", alerts, c.alerts, cmp.Diff(alerts, c.alerts))
+			}
+			if got := c.policy.String(); got != c.want {
+				t.Fatalf("unexpected value from StreakPolicy.String:\n\t(GOT): %#v\n\t(WNT): %#v", got, c.want)
+			}
+		})
+	}
+}
@@ -2,9 +2,15 @@ package discord
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -18,8 +24,37 @@ type Message struct {
 	TTS       bool         `json:"tts,omitempty"`        // Activate Text-to-Speech
 	Embeds    []Embed      `json:"embeds,omitempty"`     // Embeds
 	Files     []Attachment `json:"-"`                    // Attachments
+
+	AllowedMentions *AllowedMentions `json:"allowed_mentions,omitempty"` // Mentions which ping
+
+	ThreadID    string   `json:"-"`                      // Thread to send the message to
+	ThreadName  string   `json:"thread_name,omitempty"`  // Name of the post to create in a forum channel
+	AppliedTags []string `json:"applied_tags,omitempty"` // Tags applied to the created forum post
 }
 
+// AllowedMentions restricts which mentions in the content of a message ping.
+// Mentions which are neither parsed nor listed are shown but do not ping.
+// https://discord.com/developers/docs/resources/message#allowed-mentions-object
+type AllowedMentions struct {
+	Parse []string `json:"parse"`           // Mention types which ping: roles, users or everyone (including @here)
+	Roles []string `json:"roles,omitempty"` // IDs of the roles which ping
+	Users []string `json:"users,omitempty"` // IDs of the users which ping
+}
+
+// EscapeMentions breaks up @everyone, @here and user, role and channel
+// mentions in s with a zero-width space, so they neither ping nor render as
+// mentions.
+func EscapeMentions(s string) string {
+	return mentionEscaper.Replace(s)
+}
+
+var mentionEscaper = strings.NewReplacer(
+	"@everyone", "@\u200beveryone",
+	"@here", "@\u200bhere",
+	"<@", "<@\u200b",
+	"<#", "<#\u200b",
+)
+
 // Embed represents an embedded object (Rich Embed)
 type Embed struct {
 	Title       string     `json:"title,omitempty"`
@@ -59,6 +94,21 @@ type Author struct {
 	IconURL string `json:"icon_url,omitempty"`
 }
 
+// A SentMessage is the message object Discord created for a webhook
+// execution with ?wait=true.
+type SentMessage struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Result is the outcome of a successful webhook request.
+type Result struct {
+	Message    SentMessage // The created message
+	RateLimits []RateLimit // Rate limits that were waited out before succeeding
+}
+
+// Attachment is a file uploaded alongside the message.
 type Attachment struct {
 	Filename string
 	Data     []byte
@@ -68,31 +118,233 @@ func (d *Message) ToJSON() ([]byte, error) {
 	return json.Marshal(d)
 }
 
-// Send sends the message to the webhook URL.
-func Send(url string, m *Message, maxRetryTime time.Duration) error {
-	buf, err := json.Marshal(m)
+// fileRef refers to an attachment of a message by the index of its files[n]
+// part.
+type fileRef struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+}
+
+// encode returns the request body and its content type. Messages without
+// files are sent as JSON, otherwise as multipart/form-data with the JSON in
+// the payload_json part and one files[n] part per attachment. If
+// replaceFiles, the payload lists exactly these files as its attachments, so
+// an edit drops the files of the previous message instead of keeping them.
+func (d *Message) encode(replaceFiles bool) ([]byte, string, error) {
+	var payload []byte
+	var err error
+	if replaceFiles {
+		refs := make([]fileRef, len(d.Files))
+		for i, f := range d.Files {
+			refs[i] = fileRef{ID: i, Filename: f.Filename}
+		}
+		payload, err = json.Marshal(struct {
+			*Message
+			Attachments []fileRef `json:"attachments"`
+		}{d, refs})
+	} else {
+		payload, err = d.ToJSON()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(d.Files) == 0 {
+		return payload, "application/json", nil
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.WriteField("payload_json", string(payload)); err != nil {
+		return nil, "", err
+	}
+
+	for i, f := range d.Files {
+		part, err := w.CreateFormFile(fmt.Sprintf("files[%d]", i), f.Filename)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(f.Data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+// DefaultUserAgent is the User-Agent of requests of a Client without one.
+const DefaultUserAgent = "concourse-discord-alert-resource"
+
+// A Client sends messages to Discord webhooks.
+//
+// Rate limits are waited out for as long as Discord asks, server errors are
+// retried with an exponential backoff until MaxRetryTime has elapsed. Other
+// client errors are returned immediately as an *APIError.
+type Client struct {
+	// HTTPClient is used for all requests, e.g. to set a timeout, proxy or
+	// custom CA bundle. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// BaseURL replaces the part of webhook URLs before /webhooks, e.g.
+	// https://discord.com/api/v10 or a proxy. If blank, webhook URLs are used
+	// as is.
+	BaseURL string
+	// UserAgent is the User-Agent header of requests. If blank,
+	// DefaultUserAgent is used.
+	UserAgent string
+	// MaxRetryTime is how long failed requests are retried. If zero, requests
+	// are retried until the context is done.
+	MaxRetryTime time.Duration
+}
+
+// Send sends the message to the webhook and returns the created message.
+func (c *Client) Send(ctx context.Context, webhook *Webhook, m *Message) (*Result, error) {
+	u, err := c.webhookURL(webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without wait=true Discord responds with 204 No Content.
+	q := u.Query()
+	q.Set("wait", "true")
+	if m.ThreadID != "" {
+		q.Set("thread_id", m.ThreadID)
+	}
+	u.RawQuery = q.Encode()
+
+	return c.do(ctx, webhook, http.MethodPost, u, m)
+}
+
+// Edit replaces the contents of a message previously sent by the webhook
+// with the message and returns the edited message. The files of the previous
+// message are replaced by those of the message.
+func (c *Client) Edit(ctx context.Context, webhook *Webhook, messageID string, m *Message) (*Result, error) {
+	u, err := c.messageURL(webhook, messageID, m.ThreadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(ctx, webhook, http.MethodPatch, u, m)
+}
+
+// Delete deletes a message previously sent by the webhook. The threadID must
+// be set if the message was sent to a thread.
+func (c *Client) Delete(ctx context.Context, webhook *Webhook, messageID, threadID string) (*Result, error) {
+	u, err := c.messageURL(webhook, messageID, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(ctx, webhook, http.MethodDelete, u, nil)
+}
+
+// webhookURL returns the URL of the webhook, relative to the BaseURL if set.
+func (c *Client) webhookURL(webhook *Webhook) (*url.URL, error) {
+	u := webhook.URL()
+	if c.BaseURL == "" {
+		return u, nil
+	}
+
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	base.Path = path.Join(base.Path, "webhooks", webhook.ID, webhook.Token)
+	base.RawQuery = u.RawQuery
+	return base, nil
+}
+
+// messageURL returns the URL of a message sent by the webhook.
+func (c *Client) messageURL(webhook *Webhook, messageID, threadID string) (*url.URL, error) {
+	if messageID == "" {
+		return nil, errors.New("message id cannot be blank")
+	}
+
+	u, err := c.webhookURL(webhook)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if c.BaseURL == "" {
+		// Messages are relative to the webhook, not to suffixes like /slack.
+		u.Path = webhook.path
+		u.RawPath = ""
+	}
+	u.Path = path.Join(u.Path, "messages", messageID)
+	if threadID != "" {
+		q := u.Query()
+		q.Set("thread_id", threadID)
+		u.RawQuery = q.Encode()
+	}
+	return u, nil
+}
+
+// do executes the webhook request with the retry policy of the Client. The
+// request has no body if the message is nil. The webhook token is redacted
+// from errors.
+func (c *Client) do(ctx context.Context, webhook *Webhook, method string, u *url.URL, m *Message) (*Result, error) {
+	var buf []byte
+	var contentType string
+	if m != nil {
+		var err error
+		buf, contentType, err = m.encode(method == http.MethodPatch)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	err = backoff.Retry(
+	conn := c.HTTPClient
+	if conn == nil {
+		conn = http.DefaultClient
+	}
+	userAgent := c.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	result := &Result{}
+	policy := newRetryPolicy(c.MaxRetryTime)
+	err := backoff.Retry(
 		func() error {
-			r, err := http.Post(url, "application/json", bytes.NewReader(buf))
+			req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(buf))
+			if err != nil {
+				return backoff.Permanent(webhook.redact(err))
+			}
+			req.Header.Set("User-Agent", userAgent)
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+
+			r, err := conn.Do(req)
 			if err != nil {
-				return err
+				return webhook.redact(err)
 			}
 			defer r.Body.Close()
 
+			if r.StatusCode == http.StatusTooManyRequests {
+				limit := parseRateLimit(r)
+				result.RateLimits = append(result.RateLimits, limit)
+				policy.retryAfter = limit.RetryAfter
+				return fmt.Errorf("rate limited by Discord: %s", limit)
+			}
 			if r.StatusCode > 399 {
-				return fmt.Errorf("unexpected response status code: '%d'! Payload: %s", r.StatusCode, buf)
+				apiErr := parseAPIError(r)
+				if !isTemporary(r.StatusCode) {
+					return backoff.Permanent(apiErr)
+				}
+				return apiErr
 			}
+
+			// The message was delivered even if the response cannot be
+			// decoded, so this must not cause a retry.
+			json.NewDecoder(r.Body).Decode(&result.Message)
 			return nil
 		},
-		backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(maxRetryTime)),
+		backoff.WithContext(policy, ctx),
 	)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return result, nil
 }
@@ -1,6 +1,11 @@
 package discord
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -11,6 +16,9 @@ func TestSend(t *testing.T) {
 	cases := map[string]struct {
 		message *Message
 		backoff uint8
+		status  int
+		tries   int
+		want    SentMessage
 		wantErr bool
 	}{
 		"ok": {
@@ -20,10 +28,23 @@ func TestSend(t *testing.T) {
 		"retry ok": {
 			message: &Message{Content: "concourse"},
 			backoff: 1,
+			status:  http.StatusBadGateway,
 		},
 		"retry fail": {
 			message: &Message{Content: "concourse"},
 			backoff: 255,
+			status:  http.StatusBadGateway,
+			wantErr: true,
+		},
+		"message": {
+			message: &Message{Content: "concourse"},
+			want:    SentMessage{ID: "1", ChannelID: "2", Timestamp: "2026-10-17T12:00:00.000000+00:00"},
+		},
+		"permanent fail": {
+			message: &Message{Content: "concourse"},
+			backoff: 255,
+			status:  http.StatusUnauthorized,
+			tries:   1,
 			wantErr: true,
 		},
 	}
@@ -31,21 +52,355 @@ func TestSend(t *testing.T) {
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			tries := c.backoff
+			requests := 0
 
 			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
 				if tries > 0 {
 					tries--
-					http.Error(w, "", http.StatusUnauthorized)
+					http.Error(w, "", c.status)
+					return
+				}
+				if r.URL.Query().Get("wait") != "true" {
+					http.Error(w, "missing wait", http.StatusBadRequest)
+					return
 				}
+				json.NewEncoder(w).Encode(c.want)
 			}))
 			defer s.Close()
 
-			err := Send(s.URL, c.message, 2*time.Second)
+			got, err := (&Client{MaxRetryTime: 2 * time.Second}).Send(context.Background(), testWebhook(t, s), c.message)
 			if err != nil && !c.wantErr {
 				t.Fatalf("unexpected error from Send:\n\t(ERR): %s", err)
 			} else if err == nil && c.wantErr {
 				t.Fatalf("expected an error from Send:\n\t(GOT): nil")
+			} else if c.tries > 0 && requests != c.tries {
+				t.Fatalf("unexpected number of requests from Send:\n\t(GOT): %d\n\t(WNT): %d", requests, c.tries)
+			} else if err == nil && got.Message != c.want {
+				t.Fatalf("unexpected SentMessage from Send:\n\t(GOT): %#v\n\t(WNT): %#v", got.Message, c.want)
+			}
+		})
+	}
+}
+
+func TestSendFiles(t *testing.T) {
+	message := &Message{
+		Content: "concourse",
+		Files: []Attachment{
+			{Filename: "report.txt", Data: []byte("all tests passed")},
+			{Filename: "build.log", Data: []byte("ok")},
+		},
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var got Message
+		if err := json.Unmarshal([]byte(r.FormValue("payload_json")), &got); err != nil || got.Content != message.Content {
+			http.Error(w, "bad payload_json", http.StatusBadRequest)
+			return
+		}
+
+		for i, want := range message.Files {
+			f, h, err := r.FormFile(fmt.Sprintf("files[%d]", i))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(f)
+			if h.Filename != want.Filename || string(data) != string(want.Data) {
+				http.Error(w, "bad file", http.StatusBadRequest)
+				return
+			}
+		}
+	}))
+	defer s.Close()
+
+	_, err := (&Client{MaxRetryTime: time.Second}).Send(context.Background(), testWebhook(t, s), message)
+	if err != nil {
+		t.Fatalf("unexpected error from Send:\n\t(ERR): %s", err)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	cases := map[string]struct {
+		messageID string
+		files     []Attachment
+		suffix    string // Of the webhook URL, e.g. /slack
+		wantErr   bool
+	}{
+		"ok": {
+			messageID: "42",
+		},
+		"webhook with suffix": {
+			messageID: "42",
+			suffix:    "/slack",
+		},
+		"files": {
+			messageID: "42",
+			files:     []Attachment{{Filename: "favicon-succeeded.png", Data: []byte("png")}},
+		},
+		"unknown message": {
+			messageID: "43",
+			wantErr:   true,
+		},
+		"blank message id": {
+			wantErr: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPatch {
+					http.Error(w, "", http.StatusMethodNotAllowed)
+					return
+				}
+				if r.URL.Path != "/api/webhooks/1/token/messages/42" {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"message": "Unknown Message", "code": 10008}`))
+					return
+				}
+
+				// Only the files of the edit may remain on the message.
+				payload := r.FormValue("payload_json")
+				if len(c.files) == 0 {
+					body, _ := io.ReadAll(r.Body)
+					payload = string(body)
+				}
+				var got struct {
+					Content     string    `json:"content"`
+					Attachments []fileRef `json:"attachments"`
+				}
+				if err := json.Unmarshal([]byte(payload), &got); err != nil || got.Content != "concourse" || got.Attachments == nil {
+					http.Error(w, "bad payload", http.StatusBadRequest)
+					return
+				}
+				for i, f := range c.files {
+					file, header, err := r.FormFile(fmt.Sprintf("files[%d]", i))
+					if err != nil || len(got.Attachments) != len(c.files) || got.Attachments[i] != (fileRef{ID: i, Filename: f.Filename}) || header.Filename != f.Filename {
+						http.Error(w, "bad files", http.StatusBadRequest)
+						return
+					}
+					file.Close()
+				}
+				if len(got.Attachments) != len(c.files) {
+					http.Error(w, "bad attachments", http.StatusBadRequest)
+					return
+				}
+				json.NewEncoder(w).Encode(SentMessage{ID: "42", ChannelID: "2"})
+			}))
+			defer s.Close()
+
+			webhook, err := ParseWebhook(s.URL + "/api/webhooks/1/token" + c.suffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := (&Client{MaxRetryTime: time.Second}).Edit(context.Background(), webhook, c.messageID, &Message{Content: "concourse", Files: c.files})
+			if err != nil && !c.wantErr {
+				t.Fatalf("unexpected error from Edit:\n\t(ERR): %s", err)
+			} else if err == nil && c.wantErr {
+				t.Fatalf("expected an error from Edit:\n\t(GOT): nil")
+			} else if err == nil && got.Message.ID != c.messageID {
+				t.Fatalf("unexpected SentMessage from Edit:\n\t(GOT): %#v\n\t(WNT): %#v", got.Message.ID, c.messageID)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	cases := map[string]struct {
+		messageID string
+		wantErr   bool
+	}{
+		"ok": {
+			messageID: "42",
+		},
+		"unknown message": {
+			messageID: "43",
+			wantErr:   true,
+		},
+		"blank message id": {
+			wantErr: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodDelete {
+					http.Error(w, "", http.StatusMethodNotAllowed)
+					return
+				}
+				if r.URL.Path != "/api/webhooks/1/token/messages/42" {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"message": "Unknown Message", "code": 10008}`))
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer s.Close()
+
+			_, err := (&Client{MaxRetryTime: time.Second}).Delete(context.Background(), testWebhook(t, s), c.messageID, "")
+			if err != nil && !c.wantErr {
+				t.Fatalf("unexpected error from Delete:\n\t(ERR): %s", err)
+			} else if err == nil && c.wantErr {
+				t.Fatalf("expected an error from Delete:\n\t(GOT): nil")
+			}
+		})
+	}
+}
+
+func TestSendThread(t *testing.T) {
+	cases := map[string]struct {
+		message  *Message
+		threadID string
+	}{
+		"thread": {
+			message:  &Message{Content: "concourse", ThreadID: "99"},
+			threadID: "99",
+		},
+		"forum post": {
+			message: &Message{Content: "concourse", ThreadName: "demo", AppliedTags: []string{"1", "2"}},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.Query().Get("thread_id"); got != c.threadID {
+					http.Error(w, "unexpected thread_id "+got, http.StatusBadRequest)
+					return
+				}
+
+				var got Message
+				json.NewDecoder(r.Body).Decode(&got)
+				if got.ThreadName != c.message.ThreadName || fmt.Sprint(got.AppliedTags) != fmt.Sprint(c.message.AppliedTags) {
+					http.Error(w, "unexpected forum post", http.StatusBadRequest)
+					return
+				}
+			}))
+			defer s.Close()
+
+			_, err := (&Client{MaxRetryTime: time.Second}).Send(context.Background(), testWebhook(t, s), c.message)
+			if err != nil {
+				t.Fatalf("unexpected error from Send:\n\t(ERR): %s", err)
+			}
+		})
+	}
+}
+
+// testWebhook returns a webhook of the test server.
+func testWebhook(t *testing.T, s *httptest.Server) *Webhook {
+	t.Helper()
+	w, err := ParseWebhook(s.URL + "/api/webhooks/1/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// roundTripFunc is an http.RoundTripper injected into the Client.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestClient(t *testing.T) {
+	webhook, err := ParseWebhook("https://discord.com/api/webhooks/1/token?thread_id=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		client    *Client
+		url       string
+		userAgent string
+	}{
+		"defaults": {
+			client:    &Client{},
+			url:       "https://discord.com/api/webhooks/1/token?thread_id=2&wait=true",
+			userAgent: DefaultUserAgent,
+		},
+		"base url": {
+			client:    &Client{BaseURL: "http://proxy.example.com/discord/api/v10", UserAgent: "pipeline/1.0"},
+			url:       "http://proxy.example.com/discord/api/v10/webhooks/1/token?thread_id=2&wait=true",
+			userAgent: "pipeline/1.0",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var got *http.Request
+			c.client.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				got = r
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})}
+
+			_, err := c.client.Send(context.Background(), webhook, &Message{Content: "concourse"})
+			if err != nil {
+				t.Fatalf("unexpected error from Send:\n\t(ERR): %s", err)
+			} else if got.URL.String() != c.url {
+				t.Fatalf("unexpected request URL from Send:\n\t(GOT): %s\n\t(WNT): %s", got.URL, c.url)
+			} else if got.UserAgent() != c.userAgent {
+				t.Fatalf("unexpected User-Agent from Send:\n\t(GOT): %s\n\t(WNT): %s", got.UserAgent(), c.userAgent)
 			}
 		})
 	}
 }
+
+func TestClientCancel(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", http.StatusBadGateway)
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := (&Client{}).Send(ctx, testWebhook(t, s), &Message{Content: "concourse"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error from Send:\n\t(GOT): %v\n\t(WNT): %v", err, context.DeadlineExceeded)
+	} else if time.Since(start) > time.Second {
+		t.Fatalf("Send did not stop retrying when the context was done")
+	}
+}
+
+func TestEscapeMentions(t *testing.T) {
+	cases := map[string]string{
+		"build failed": "build failed",
+		"@everyone":    "@\u200beveryone",
+		"@here ping":   "@\u200bhere ping",
+		"<@1234>":      "<@\u200b1234>",
+		"<@!1234>":     "<@\u200b!1234>",
+		"<@&1234> hi":  "<@\u200b&1234> hi",
+		"see <#1234>":  "see <#\u200b1234>",
+		"me@email.com": "me@email.com",
+	}
+
+	for s, want := range cases {
+		t.Run(s, func(t *testing.T) {
+			got := EscapeMentions(s)
+			if got != want {
+				t.Fatalf("unexpected string from EscapeMentions:\n\t(GOT): %q\n\t(WNT): %q", got, want)
+			}
+		})
+	}
+}
+
+func TestAllowedMentionsJSON(t *testing.T) {
+	m := &Message{Content: "@everyone", AllowedMentions: &AllowedMentions{Parse: []string{}}}
+	got, err := m.ToJSON()
+	if err != nil {
+		t.Fatalf("unexpected error from ToJSON:\n\t(ERR): %s", err)
+	}
+
+	want := `{"content":"@everyone","allowed_mentions":{"parse":[]}}`
+	if string(got) != want {
+		t.Fatalf("unexpected JSON from ToJSON:\n\t(GOT): %s\n\t(WNT): %s", got, want)
+	}
+}
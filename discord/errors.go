@@ -0,0 +1,132 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An APIError is an error response of the Discord API.
+// https://discord.com/developers/docs/reference#error-messages
+type APIError struct {
+	StatusCode int
+	Code       int          // JSON error code, e.g. 10015 (Unknown Webhook)
+	Message    string       // Error message, e.g. "Invalid Form Body"
+	Errors     []FieldError // Errors of individual fields of the payload
+}
+
+// A FieldError is an error of a single field of the payload.
+type FieldError struct {
+	Path    string // Path of the field, e.g. "embeds[0].fields[1].value"
+	Code    string // Error code, e.g. "BASE_TYPE_MAX_LENGTH"
+	Message string // Error message, e.g. "Must be 1024 or fewer in length."
+}
+
+func (e FieldError) String() string {
+	msg := strings.TrimSuffix(e.Message, ".")
+	if r, size := utf8.DecodeRuneInString(msg); r != utf8.RuneError {
+		msg = string(unicode.ToLower(r)) + msg[size:]
+	}
+	if e.Path == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s %s", e.Path, msg)
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("discord responded with status %d: %s", e.StatusCode, e.Message)
+	if e.Code != 0 {
+		msg = fmt.Sprintf("%s (code %d)", msg, e.Code)
+	}
+	for _, f := range e.Errors {
+		msg += "; " + f.String()
+	}
+	return msg
+}
+
+// isTemporary reports whether a response status code is worth retrying.
+// Client errors will fail the same way again, except for rate limits and
+// timeouts.
+func isTemporary(code int) bool {
+	switch {
+	case code == http.StatusTooManyRequests, code == http.StatusRequestTimeout:
+		return true
+	case code >= 400 && code < 500:
+		return false
+	}
+	return true
+}
+
+// parseAPIError decodes the error body of a response. Bodies which are not
+// JSON (e.g. from a proxy) only set the StatusCode and Message.
+func parseAPIError(r *http.Response) *APIError {
+	var body struct {
+		Code    int            `json:"code"`
+		Message string         `json:"message"`
+		Errors  map[string]any `json:"errors"`
+	}
+	data, _ := io.ReadAll(r.Body)
+
+	e := &APIError{StatusCode: r.StatusCode}
+	if err := json.Unmarshal(data, &body); err != nil || body.Message == "" {
+		e.Message = http.StatusText(r.StatusCode)
+		return e
+	}
+
+	e.Code = body.Code
+	e.Message = body.Message
+	e.Errors = flattenErrors("", body.Errors)
+	return e
+}
+
+// flattenErrors walks the nested errors object of Discord, where each level is
+// keyed by a field name or array index and the leaves are _errors lists.
+func flattenErrors(path string, errs map[string]any) []FieldError {
+	keys := make([]string, 0, len(errs))
+	for k := range errs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, aerr := strconv.Atoi(keys[i])
+		b, berr := strconv.Atoi(keys[j])
+		if aerr == nil && berr == nil {
+			return a < b
+		}
+		return keys[i] < keys[j]
+	})
+
+	var fields []FieldError
+	for _, k := range keys {
+		switch v := errs[k].(type) {
+		case []any:
+			if k != "_errors" {
+				continue
+			}
+			for _, item := range v {
+				m, _ := item.(map[string]any)
+				code, _ := m["code"].(string)
+				msg, _ := m["message"].(string)
+				fields = append(fields, FieldError{Path: path, Code: code, Message: msg})
+			}
+		case map[string]any:
+			fields = append(fields, flattenErrors(joinPath(path, k), v)...)
+		}
+	}
+	return fields
+}
+
+func joinPath(path, key string) string {
+	if _, err := strconv.Atoi(key); err == nil {
+		return fmt.Sprintf("%s[%s]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
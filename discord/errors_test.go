@@ -0,0 +1,62 @@
+package discord
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAPIError(t *testing.T) {
+	cases := map[string]struct {
+		status int
+		body   string
+		want   *APIError
+		msg    string
+	}{
+		"unknown webhook": {
+			status: http.StatusNotFound,
+			body:   `{"message": "Unknown Webhook", "code": 10015}`,
+			want:   &APIError{StatusCode: 404, Code: 10015, Message: "Unknown Webhook"},
+			msg:    "discord responded with status 404: Unknown Webhook (code 10015)",
+		},
+		"invalid form body": {
+			status: http.StatusBadRequest,
+			body: `{"code": 50035, "errors": {"embeds": {
+				"0": {"fields": {"1": {"value": {"_errors": [{"code": "BASE_TYPE_MAX_LENGTH", "message": "Must be 1024 or fewer in length."}]}}}},
+				"10": {"title": {"_errors": [{"code": "BASE_TYPE_REQUIRED", "message": "This field is required"}]}},
+				"2": {"color": {"_errors": [{"code": "NUMBER_TYPE_MAX", "message": "int value should be less than or equal to 16777215."}]}}
+			}}, "message": "Invalid Form Body"}`,
+			want: &APIError{StatusCode: 400, Code: 50035, Message: "Invalid Form Body", Errors: []FieldError{
+				{Path: "embeds[0].fields[1].value", Code: "BASE_TYPE_MAX_LENGTH", Message: "Must be 1024 or fewer in length."},
+				{Path: "embeds[2].color", Code: "NUMBER_TYPE_MAX", Message: "int value should be less than or equal to 16777215."},
+				{Path: "embeds[10].title", Code: "BASE_TYPE_REQUIRED", Message: "This field is required"},
+			}},
+			msg: "discord responded with status 400: Invalid Form Body (code 50035); " +
+				"embeds[0].fields[1].value must be 1024 or fewer in length; " +
+				"embeds[2].color int value should be less than or equal to 16777215; " +
+				"embeds[10].title this field is required",
+		},
+		"not json": {
+			status: http.StatusForbidden,
+			body:   "<html>Forbidden</html>",
+			want:   &APIError{StatusCode: 403, Message: "Forbidden"},
+			msg:    "discord responded with status 403: Forbidden",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &http.Response{StatusCode: c.status, Body: io.NopCloser(strings.NewReader(c.body))}
+
+			got := parseAPIError(r)
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected APIError from parseAPIError:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			} else if got.Error() != c.msg {
+				t.Fatalf("unexpected message from APIError:\n\t(GOT): %s\n\t(WNT): %s", got.Error(), c.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of a webhook message. Lengths are in characters.
+// https://discord.com/developers/docs/resources/message#embed-object-embed-limits
+const (
+	MaxContentLength     = 2000
+	MaxUsernameLength    = 80
+	MaxEmbeds            = 10
+	MaxEmbedsLength      = 6000 // Combined length of all embeds of a message
+	MaxTitleLength       = 256
+	MaxDescriptionLength = 4096
+	MaxFields            = 25
+	MaxFieldNameLength   = 256
+	MaxFieldValueLength  = 1024
+	MaxFooterLength      = 2048
+	MaxAuthorNameLength  = 256
+	MaxFiles             = 10
+	MaxAllowedMentions   = 100 // Roles and users each
+)
+
+// Overflow is how a message exceeding the limits is made to fit.
+type Overflow string
+
+const (
+	// OverflowTruncate cuts texts to their limits, ending them with an ellipsis.
+	OverflowTruncate Overflow = "truncate"
+	// OverflowSplit spreads long texts across several embeds and messages.
+	OverflowSplit Overflow = "split"
+	// OverflowAttach truncates like OverflowTruncate and uploads the full texts
+	// as message.txt.
+	OverflowAttach Overflow = "attach"
+)
+
+const ellipsis = "…"
+
+// A LimitError is a part of a message which exceeds its limit.
+type LimitError struct {
+	Path   string // Path of the field, e.g. "embeds[0].title"
+	Length int
+	Max    int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s exceeds the limit of %d (is %d)", e.Path, e.Max, e.Length)
+}
+
+// Validate checks the message against all limits of Discord. The returned
+// error joins a *LimitError for every exceeded limit.
+func (d *Message) Validate() error {
+	var errs []error
+	check := func(path string, length, max int) {
+		if length > max {
+			errs = append(errs, &LimitError{Path: path, Length: length, Max: max})
+		}
+	}
+
+	check("content", length(d.Content), MaxContentLength)
+	check("username", length(d.Username), MaxUsernameLength)
+	check("embeds", len(d.Embeds), MaxEmbeds)
+	check("files", len(d.Files), MaxFiles)
+	if d.AllowedMentions != nil {
+		check("allowed_mentions.roles", len(d.AllowedMentions.Roles), MaxAllowedMentions)
+		check("allowed_mentions.users", len(d.AllowedMentions.Users), MaxAllowedMentions)
+	}
+
+	total := 0
+	for i, e := range d.Embeds {
+		path := fmt.Sprintf("embeds[%d]", i)
+		check(path+".title", length(e.Title), MaxTitleLength)
+		check(path+".description", length(e.Description), MaxDescriptionLength)
+		check(path+".fields", len(e.Fields), MaxFields)
+		for j, f := range e.Fields {
+			check(fmt.Sprintf("%s.fields[%d].name", path, j), length(f.Name), MaxFieldNameLength)
+			check(fmt.Sprintf("%s.fields[%d].value", path, j), length(f.Value), MaxFieldValueLength)
+		}
+		if e.Footer != nil {
+			check(path+".footer.text", length(e.Footer.Text), MaxFooterLength)
+		}
+		if e.Author != nil {
+			check(path+".author.name", length(e.Author.Name), MaxAuthorNameLength)
+		}
+		total += e.length()
+	}
+	check("embeds (combined)", total, MaxEmbedsLength)
+
+	return errors.Join(errs...)
+}
+
+// Fit returns the message as one or more messages within the limits of
+// Discord, according to overflow. An empty overflow truncates.
+func (d *Message) Fit(overflow Overflow) ([]*Message, error) {
+	switch overflow {
+	case "", OverflowTruncate:
+		m := d.copy()
+		m.truncate()
+		return []*Message{m}, nil
+	case OverflowAttach:
+		m := d.copy()
+		full := m.truncate()
+		if len(full) > 0 {
+			m.Files = append(m.Files, Attachment{Filename: "message.txt", Data: []byte(strings.Join(full, "\n\n"))})
+		}
+		return []*Message{m}, nil
+	case OverflowSplit:
+		return d.split(), nil
+	}
+	return nil, fmt.Errorf("unknown overflow %q: must be one of %q, %q or %q", overflow, OverflowTruncate, OverflowSplit, OverflowAttach)
+}
+
+// copy returns a copy of the message which can be changed without changing
+// the embeds of the original.
+func (d *Message) copy() *Message {
+	m := *d
+	m.Embeds = nil
+	for _, e := range d.Embeds {
+		e.Fields = append([]Field(nil), e.Fields...)
+		if e.Footer != nil {
+			footer := *e.Footer
+			e.Footer = &footer
+		}
+		if e.Author != nil {
+			author := *e.Author
+			e.Author = &author
+		}
+		m.Embeds = append(m.Embeds, e)
+	}
+	m.Files = append([]Attachment(nil), d.Files...)
+	return &m
+}
+
+// truncate cuts every text of the message to its limit and drops the embeds
+// and fields exceeding the limits. The full texts which were cut or dropped
+// are returned.
+func (d *Message) truncate() []string {
+	var full []string
+	cut := func(s *string, max int) {
+		if length(*s) > max {
+			full = append(full, *s)
+			*s = truncate(*s, max)
+		}
+	}
+
+	cut(&d.Content, MaxContentLength)
+	d.Username = truncate(d.Username, MaxUsernameLength)
+
+	if len(d.Embeds) > MaxEmbeds {
+		for _, e := range d.Embeds[MaxEmbeds:] {
+			full = append(full, e.text())
+		}
+		d.Embeds = d.Embeds[:MaxEmbeds]
+	}
+
+	for i := range d.Embeds {
+		e := &d.Embeds[i]
+		cut(&e.Title, MaxTitleLength)
+		cut(&e.Description, MaxDescriptionLength)
+		if len(e.Fields) > MaxFields {
+			for _, f := range e.Fields[MaxFields:] {
+				full = append(full, f.Name+"\n"+f.Value)
+			}
+			e.Fields = e.Fields[:MaxFields]
+		}
+		for j := range e.Fields {
+			cut(&e.Fields[j].Name, MaxFieldNameLength)
+			cut(&e.Fields[j].Value, MaxFieldValueLength)
+		}
+		if e.Footer != nil {
+			cut(&e.Footer.Text, MaxFooterLength)
+		}
+		if e.Author != nil {
+			cut(&e.Author.Name, MaxAuthorNameLength)
+		}
+	}
+
+	// Shorten descriptions, starting with the last embed, then drop whole
+	// embeds and then trailing fields until the combined length fits.
+	excess := -MaxEmbedsLength
+	for _, e := range d.Embeds {
+		excess += e.length()
+	}
+	for i := len(d.Embeds) - 1; i >= 0 && excess > 0; i-- {
+		e := &d.Embeds[i]
+		n := length(e.Description)
+		if n == 0 {
+			continue
+		}
+		if n > excess {
+			full = append(full, e.Description)
+			e.Description = truncate(e.Description, n-excess)
+			excess = 0
+			break
+		}
+		full = append(full, e.Description)
+		e.Description = ""
+		excess -= n
+	}
+	for excess > 0 && len(d.Embeds) > 1 {
+		last := d.Embeds[len(d.Embeds)-1]
+		full = append(full, last.text())
+		excess -= last.length()
+		d.Embeds = d.Embeds[:len(d.Embeds)-1]
+	}
+	for i := len(d.Embeds) - 1; i >= 0 && excess > 0; i-- {
+		e := &d.Embeds[i]
+		for excess > 0 && len(e.Fields) > 0 {
+			f := &e.Fields[len(e.Fields)-1]
+			full = append(full, f.Name+"\n"+f.Value)
+			if n := length(f.Value); n-excess >= length(ellipsis) {
+				f.Value = truncate(f.Value, n-excess)
+				excess = 0
+				break
+			}
+			excess -= length(f.Name) + length(f.Value)
+			e.Fields = e.Fields[:len(e.Fields)-1]
+		}
+	}
+
+	return full
+}
+
+// split spreads long titles and descriptions and too many fields across
+// continuation embeds, and the embeds across as many messages as needed.
+// Texts which cannot be split, like field values, are truncated.
+func (d *Message) split() []*Message {
+	var embeds []Embed
+	for _, e := range d.Embeds {
+		embeds = append(embeds, splitEmbed(e)...)
+	}
+
+	var messages []*Message
+	m := &Message{}
+	total := 0
+	for _, e := range embeds {
+		n := e.length()
+		if len(m.Embeds) > 0 && (len(m.Embeds) == MaxEmbeds || total+n > MaxEmbedsLength) {
+			messages = append(messages, m)
+			m = &Message{}
+			total = 0
+		}
+		m.Embeds = append(m.Embeds, e)
+		total += n
+	}
+	messages = append(messages, m)
+
+	for i, m := range messages {
+		m.Username = d.Username
+		m.AvatarURL = d.AvatarURL
+		m.TTS = d.TTS
+		m.AllowedMentions = d.AllowedMentions
+		m.ThreadID = d.ThreadID
+		// Only the first message mentions, uploads and creates a forum post.
+		if i == 0 {
+			m.Content = d.Content
+			m.Files = append([]Attachment(nil), d.Files...)
+			m.ThreadName = d.ThreadName
+			m.AppliedTags = d.AppliedTags
+		}
+		m.truncate()
+	}
+	return messages
+}
+
+// splitEmbed splits an embed into the embed and its continuations. The title,
+// URL and author stay with the first embed, the fields follow the description
+// in as many embeds as needed, and the footer, image and timestamp move to the
+// last.
+func splitEmbed(e Embed) []Embed {
+	title := e.Title
+	description := e.Description
+	if length(title) > MaxTitleLength {
+		parts := splitText(title, MaxTitleLength)
+		title = parts[0]
+		rest := strings.TrimSpace(strings.TrimPrefix(e.Title, title))
+		description = strings.TrimSpace(rest + "\n\n" + description)
+	}
+
+	var embeds []Embed
+	for _, chunk := range splitText(description, MaxDescriptionLength) {
+		embeds = append(embeds, Embed{Description: chunk, Color: e.Color})
+	}
+	if len(embeds) == 0 {
+		embeds = []Embed{{Color: e.Color}}
+	}
+
+	first := &embeds[0]
+	first.Title = title
+	first.URL = e.URL
+	first.Author = e.Author
+	first.Thumbnail = e.Thumbnail
+
+	// Fields continue in a new embed once there are too many of them or they
+	// would exceed the combined length.
+	for _, f := range e.Fields {
+		last := &embeds[len(embeds)-1]
+		n := length(f.Name) + length(f.Value)
+		if len(last.Fields) == MaxFields || (len(last.Fields) > 0 && last.length()+n > MaxEmbedsLength) {
+			embeds = append(embeds, Embed{Color: e.Color})
+			last = &embeds[len(embeds)-1]
+		}
+		last.Fields = append(last.Fields, f)
+	}
+
+	last := &embeds[len(embeds)-1]
+	last.Footer = e.Footer
+	last.Image = e.Image
+	last.Timestamp = e.Timestamp
+
+	return embeds
+}
+
+// splitText splits s into chunks of at most max characters, preferably at
+// line breaks and otherwise at spaces.
+func splitText(s string, max int) []string {
+	var chunks []string
+	for length(s) > max {
+		runes := []rune(s)
+		head := string(runes[:max])
+		i := strings.LastIndex(head, "\n")
+		if i <= 0 {
+			i = strings.LastIndex(head, " ")
+		}
+		if i <= 0 {
+			i = len(head)
+		}
+		chunks = append(chunks, strings.TrimRight(s[:i], " \n"))
+		s = strings.TrimLeft(s[i:], " \n")
+	}
+	if s = strings.TrimRight(s, " \n"); s != "" {
+		chunks = append(chunks, s)
+	}
+	return chunks
+}
+
+// truncate cuts s to max characters, ending it with an ellipsis.
+func truncate(s string, max int) string {
+	if length(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max-utf8.RuneCountInString(ellipsis)]) + ellipsis
+}
+
+// length is the length of s in characters as counted by Discord.
+func length(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// length is the length of the embed towards MaxEmbedsLength.
+func (e Embed) length() int {
+	n := length(e.Title) + length(e.Description)
+	for _, f := range e.Fields {
+		n += length(f.Name) + length(f.Value)
+	}
+	if e.Footer != nil {
+		n += length(e.Footer.Text)
+	}
+	if e.Author != nil {
+		n += length(e.Author.Name)
+	}
+	return n
+}
+
+// text is the embed's title and description for attaching it as text.
+func (e Embed) text() string {
+	return strings.TrimSpace(e.Title + "\n" + e.Description)
+}
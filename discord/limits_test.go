@@ -0,0 +1,211 @@
+package discord
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidate(t *testing.T) {
+	cases := map[string]struct {
+		message *Message
+		want    []LimitError
+	}{
+		"ok": {
+			message: &Message{Content: "concourse", Embeds: []Embed{{Title: "Success", Description: strings.Repeat("a", MaxDescriptionLength)}}},
+		},
+		"characters, not bytes": {
+			message: &Message{Embeds: []Embed{{Title: strings.Repeat("ü", MaxTitleLength)}}},
+		},
+		"too long": {
+			message: &Message{Embeds: []Embed{{
+				Title:  strings.Repeat("a", 300),
+				Fields: []Field{{Name: "ok", Value: "ok"}, {Name: "Log", Value: strings.Repeat("a", 2000)}},
+			}}},
+			want: []LimitError{
+				{Path: "embeds[0].title", Length: 300, Max: MaxTitleLength},
+				{Path: "embeds[0].fields[1].value", Length: 2000, Max: MaxFieldValueLength},
+			},
+		},
+		"username": {
+			message: &Message{Username: strings.Repeat("a", 81), Content: "concourse"},
+			want:    []LimitError{{Path: "username", Length: 81, Max: MaxUsernameLength}},
+		},
+		"combined": {
+			message: &Message{Embeds: []Embed{
+				{Description: strings.Repeat("a", 4000)},
+				{Description: strings.Repeat("a", 4000)},
+			}},
+			want: []LimitError{{Path: "embeds (combined)", Length: 8000, Max: MaxEmbedsLength}},
+		},
+		"too many": {
+			message: &Message{Embeds: make([]Embed, 11), Files: make([]Attachment, 12)},
+			want: []LimitError{
+				{Path: "embeds", Length: 11, Max: MaxEmbeds},
+				{Path: "files", Length: 12, Max: MaxFiles},
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var got []LimitError
+			if err := c.message.Validate(); err != nil {
+				for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+					var limit *LimitError
+					if errors.As(e, &limit) {
+						got = append(got, *limit)
+					}
+				}
+			}
+
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected errors from Validate:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			}
+		})
+	}
+}
+
+func TestFit(t *testing.T) {
+	long := strings.Repeat("word ", 1000) // 5000 characters
+	longTitle := strings.Repeat("title ", 50) + "end"
+	words := func(n int) string { return strings.TrimSpace(strings.Repeat("word ", n)) }
+	value := strings.Repeat("x", 900)
+	var fields []Field // 9030 characters
+	for i := 0; i < 10; i++ {
+		fields = append(fields, Field{Name: "Log", Value: value})
+	}
+	dropped := strings.Repeat("Log\n"+value+"\n\n", 3) + "Log\n" + value
+
+	cases := map[string]struct {
+		message  *Message
+		overflow Overflow
+		want     []*Message
+		wantErr  bool
+	}{
+		"fits": {
+			message: &Message{Username: "Concourse", Embeds: []Embed{{Title: "Success"}}},
+			want:    []*Message{{Username: "Concourse", Embeds: []Embed{{Title: "Success"}}}},
+		},
+		"truncate": {
+			message:  &Message{Embeds: []Embed{{Title: longTitle, Description: long}}},
+			overflow: OverflowTruncate,
+			want: []*Message{{Embeds: []Embed{{
+				Title:       longTitle[:MaxTitleLength-1] + ellipsis,
+				Description: long[:MaxDescriptionLength-1] + ellipsis,
+			}}}},
+		},
+		"truncate combined": {
+			message:  &Message{Embeds: []Embed{{Description: long}, {Description: long[:2000]}}},
+			overflow: OverflowTruncate,
+			want: []*Message{{Embeds: []Embed{
+				{Description: long[:MaxDescriptionLength-1] + ellipsis},
+				{Description: long[:MaxEmbedsLength-MaxDescriptionLength-1] + ellipsis},
+			}}},
+		},
+		"truncate fields": {
+			message:  &Message{Embeds: []Embed{{Title: "Failed", Fields: fields}}},
+			overflow: OverflowTruncate,
+			want: []*Message{{Embeds: []Embed{{
+				Title:  "Failed",
+				Fields: append(fields[:6:6], Field{Name: "Log", Value: value[:572] + ellipsis}),
+			}}}},
+		},
+		"attach": {
+			message:  &Message{Embeds: []Embed{{Title: "Failed", Description: long}}},
+			overflow: OverflowAttach,
+			want: []*Message{{
+				Embeds: []Embed{{Title: "Failed", Description: long[:MaxDescriptionLength-1] + ellipsis}},
+				Files:  []Attachment{{Filename: "message.txt", Data: []byte(long)}},
+			}},
+		},
+		"attach fields": {
+			message:  &Message{Embeds: []Embed{{Title: "Failed", Fields: fields}}},
+			overflow: OverflowAttach,
+			want: []*Message{{
+				Embeds: []Embed{{Title: "Failed", Fields: append(fields[:6:6], Field{Name: "Log", Value: value[:572] + ellipsis})}},
+				Files:  []Attachment{{Filename: "message.txt", Data: []byte(dropped)}},
+			}},
+		},
+		"split": {
+			message: &Message{
+				Username:   "Concourse",
+				Content:    "<@&1234>",
+				ThreadName: "demo",
+				Embeds: []Embed{{
+					Title:       "Failed",
+					Description: long + long,
+					URL:         "https://ci.example.com",
+					Color:       1,
+					Fields:      []Field{{Name: "Build", Value: "1"}},
+				}},
+			},
+			overflow: OverflowSplit,
+			want: []*Message{
+				{
+					Username:   "Concourse",
+					Content:    "<@&1234>",
+					ThreadName: "demo",
+					Embeds: []Embed{{
+						Title:       "Failed",
+						URL:         "https://ci.example.com",
+						Color:       1,
+						Description: words(819),
+					}},
+				},
+				{
+					Username: "Concourse",
+					Embeds: []Embed{
+						{Color: 1, Description: words(819)},
+						{Color: 1, Description: words(362), Fields: []Field{{Name: "Build", Value: "1"}}},
+					},
+				},
+			},
+		},
+		"split fields": {
+			message:  &Message{Embeds: []Embed{{Title: "Failed", Color: 1, Fields: fields}}},
+			overflow: OverflowSplit,
+			want: []*Message{
+				{Embeds: []Embed{{Title: "Failed", Color: 1, Fields: fields[:6]}}},
+				{Embeds: []Embed{{Color: 1, Fields: fields[6:]}}},
+			},
+		},
+		"split title": {
+			message:  &Message{Embeds: []Embed{{Title: longTitle, Description: "description"}}},
+			overflow: OverflowSplit,
+			want: []*Message{{Embeds: []Embed{{
+				Title:       strings.TrimSpace(longTitle[:252]),
+				Description: strings.Repeat("title ", 8) + "end\n\ndescription",
+			}}}},
+		},
+		"unknown": {
+			message:  &Message{},
+			overflow: "drop",
+			wantErr:  true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := c.message.Fit(c.overflow)
+			if err != nil && !c.wantErr {
+				t.Fatalf("unexpected error from Fit:\n\t(ERR): %s", err)
+			} else if err == nil && c.wantErr {
+				t.Fatalf("expected an error from Fit:\n\t(GOT): nil")
+			} else if err != nil && c.wantErr {
+				return
+			}
+
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected messages from Fit:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			}
+			for i, m := range got {
+				if err := m.Validate(); err != nil {
+					t.Fatalf("message %d from Fit exceeds limits:\n\t(ERR): %s", i, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package discord
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// A RateLimit is a rate limit Discord responded with (status 429).
+// https://discord.com/developers/docs/topics/rate-limits
+type RateLimit struct {
+	Global     bool          // The limit applies to all requests, not only this webhook
+	Scope      string        // Value of X-RateLimit-Scope: user, global or shared
+	Bucket     string        // Value of X-RateLimit-Bucket
+	RetryAfter time.Duration // How long Discord asked to wait
+}
+
+func (l RateLimit) String() string {
+	limit := "bucket"
+	if l.Bucket != "" {
+		limit = fmt.Sprintf("bucket %s", l.Bucket)
+	}
+	if l.Global {
+		limit = "global"
+	}
+	if l.Scope != "" {
+		limit = fmt.Sprintf("%s (%s)", limit, l.Scope)
+	}
+	return fmt.Sprintf("%s, retry after %s", limit, l.RetryAfter)
+}
+
+// parseRateLimit reads the rate limit from a 429 response. The JSON body's
+// retry_after is preferred, falling back to the X-RateLimit-Reset-After and
+// Retry-After headers.
+func parseRateLimit(r *http.Response) RateLimit {
+	var body struct {
+		RetryAfter float64 `json:"retry_after"`
+		Global     bool    `json:"global"`
+	}
+	// Discord always sends a JSON body, but proxies in between may not.
+	data, _ := io.ReadAll(r.Body)
+	json.Unmarshal(data, &body)
+
+	limit := RateLimit{
+		Global: body.Global || r.Header.Get("X-RateLimit-Global") == "true",
+		Scope:  r.Header.Get("X-RateLimit-Scope"),
+		Bucket: r.Header.Get("X-RateLimit-Bucket"),
+	}
+
+	seconds := body.RetryAfter
+	if seconds <= 0 {
+		seconds, _ = strconv.ParseFloat(r.Header.Get("X-RateLimit-Reset-After"), 64)
+	}
+	if seconds <= 0 {
+		seconds, _ = strconv.ParseFloat(r.Header.Get("Retry-After"), 64)
+	}
+	limit.RetryAfter = time.Duration(seconds * float64(time.Second))
+
+	return limit
+}
+
+// A retryPolicy backs off exponentially unless Discord asked to wait for a
+// specific duration, in which case it waits exactly that long. It stops once
+// maxRetryTime would be exceeded.
+type retryPolicy struct {
+	exponential  *backoff.ExponentialBackOff
+	maxRetryTime time.Duration
+	started      time.Time
+
+	// retryAfter is set by the operation when it was rate limited.
+	retryAfter time.Duration
+}
+
+func newRetryPolicy(maxRetryTime time.Duration) *retryPolicy {
+	return &retryPolicy{
+		exponential:  backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(maxRetryTime)),
+		maxRetryTime: maxRetryTime,
+		started:      time.Now(),
+	}
+}
+
+func (p *retryPolicy) Reset() {
+	p.exponential.Reset()
+	p.started = time.Now()
+	p.retryAfter = 0
+}
+
+func (p *retryPolicy) NextBackOff() time.Duration {
+	if p.retryAfter <= 0 {
+		return p.exponential.NextBackOff()
+	}
+
+	wait := p.retryAfter
+	p.retryAfter = 0
+	if p.maxRetryTime > 0 && time.Since(p.started)+wait > p.maxRetryTime {
+		return backoff.Stop
+	}
+	return wait
+}
@@ -0,0 +1,120 @@
+package discord
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	cases := map[string]struct {
+		header http.Header
+		body   string
+		want   RateLimit
+	}{
+		"body": {
+			header: http.Header{"X-Ratelimit-Bucket": {"abcd1234"}, "X-Ratelimit-Scope": {"user"}, "Retry-After": {"2"}},
+			body:   `{"message": "You are being rate limited.", "retry_after": 0.25, "global": false}`,
+			want:   RateLimit{Scope: "user", Bucket: "abcd1234", RetryAfter: 250 * time.Millisecond},
+		},
+		"global": {
+			header: http.Header{"X-Ratelimit-Global": {"true"}, "X-Ratelimit-Scope": {"global"}},
+			body:   `{"message": "You are being rate limited.", "retry_after": 1.5, "global": true}`,
+			want:   RateLimit{Global: true, Scope: "global", RetryAfter: 1500 * time.Millisecond},
+		},
+		"reset after header": {
+			header: http.Header{"X-Ratelimit-Reset-After": {"0.5"}, "Retry-After": {"1"}},
+			want:   RateLimit{RetryAfter: 500 * time.Millisecond},
+		},
+		"retry after header": {
+			header: http.Header{"Retry-After": {"3"}},
+			body:   "<html>Too Many Requests</html>",
+			want:   RateLimit{RetryAfter: 3 * time.Second},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     c.header,
+				Body:       http.NoBody,
+			}
+			if c.body != "" {
+				r.Body = io.NopCloser(strings.NewReader(c.body))
+			}
+
+			got := parseRateLimit(r)
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected RateLimit from parseRateLimit:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			}
+		})
+	}
+}
+
+func TestSendRateLimited(t *testing.T) {
+	cases := map[string]struct {
+		retryAfter string
+		limits     uint8
+		want       []RateLimit
+		wantErr    bool
+	}{
+		"waits": {
+			retryAfter: "0.2",
+			limits:     2,
+			want: []RateLimit{
+				{Scope: "user", Bucket: "abcd1234", RetryAfter: 200 * time.Millisecond},
+				{Scope: "user", Bucket: "abcd1234", RetryAfter: 200 * time.Millisecond},
+			},
+		},
+		"longer than max retry time": {
+			retryAfter: "5",
+			limits:     1,
+			wantErr:    true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			limits := c.limits
+			var last time.Time
+
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if limits > 0 {
+					limits--
+					last = time.Now()
+					w.Header().Set("X-RateLimit-Bucket", "abcd1234")
+					w.Header().Set("X-RateLimit-Scope", "user")
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusTooManyRequests)
+					w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": ` + c.retryAfter + `, "global": false}`))
+					return
+				}
+
+				if time.Since(last) < 200*time.Millisecond {
+					t.Errorf("retried before retry_after elapsed: %s", time.Since(last))
+				}
+			}))
+			defer s.Close()
+
+			got, err := (&Client{MaxRetryTime: 2 * time.Second}).Send(context.Background(), testWebhook(t, s), &Message{Content: "concourse"})
+			if err != nil && !c.wantErr {
+				t.Fatalf("unexpected error from Send:\n\t(ERR): %s", err)
+			} else if err == nil && c.wantErr {
+				t.Fatalf("expected an error from Send:\n\t(GOT): nil")
+			} else if err != nil && c.wantErr {
+				return
+			}
+
+			if !cmp.Equal(got.RateLimits, c.want) {
+				t.Fatalf("unexpected RateLimits from Send:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got.RateLimits, c.want, cmp.Diff(got.RateLimits, c.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// A Webhook is a Discord webhook URL, e.g.
+// https://discord.com/api/webhooks/{id}/{token}, or the URL of a proxy
+// relaying to one. It prints itself with the token redacted, so it can be
+// safely logged.
+type Webhook struct {
+	ID    string // Empty if the URL is not a Discord webhook URL
+	Token string // Last segment of the path if the URL is not a Discord webhook URL
+
+	url  *url.URL
+	path string // Path the messages of the webhook are relative to
+}
+
+// discordHosts are the hosts whose URLs must be Discord webhook URLs.
+var discordHosts = []string{"discord.com", "discordapp.com", "ptb.discord.com", "canary.discord.com"}
+
+// ParseWebhook parses a webhook URL. The path of Discord webhook URLs may
+// continue after the token, e.g. with /slack or /github. URLs of other hosts,
+// e.g. of proxies, are used as is and their last path segment is taken as
+// the token.
+func ParseWebhook(s string) (*Webhook, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		// The error of url.Parse contains the whole URL.
+		return nil, errors.New("invalid discord webhook url")
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := len(parts) - 3; i >= 0; i-- {
+		if parts[i] == "webhooks" && parts[i+1] != "" && parts[i+2] != "" {
+			path := "/" + strings.Join(parts[:i+3], "/")
+			return &Webhook{ID: parts[i+1], Token: parts[i+2], url: u, path: path}, nil
+		}
+	}
+	if slices.Contains(discordHosts, u.Hostname()) {
+		return nil, fmt.Errorf("invalid discord webhook url on %s: path must contain /webhooks/{id}/{token}", u.Host)
+	}
+
+	return &Webhook{Token: parts[len(parts)-1], url: u, path: u.Path}, nil
+}
+
+// URL returns the webhook URL, including its token.
+func (w *Webhook) URL() *url.URL {
+	u := *w.url
+	return &u
+}
+
+// String returns the webhook URL with the token redacted.
+func (w *Webhook) String() string {
+	u := w.URL()
+	if w.Token != "" {
+		parts := strings.Split(strings.TrimSuffix(u.Path, "/"), "/")
+		for i, p := range parts {
+			if p == w.Token {
+				parts[i] = "REDACTED"
+			}
+		}
+		u.Path = strings.Join(parts, "/")
+	}
+	u.RawPath = ""
+	return redactURL(u)
+}
+
+// GoString returns the webhook with the token redacted.
+func (w *Webhook) GoString() string {
+	return fmt.Sprintf("&discord.Webhook{ID:%q, Token:\"REDACTED\"}", w.ID)
+}
+
+// redact replaces the token of the webhook in the error of a request.
+func (w *Webhook) redact(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		uerr.URL = strings.ReplaceAll(uerr.URL, w.Token, "REDACTED")
+	}
+	return err
+}
+
+// redactURL returns the URL with its query and password removed.
+func redactURL(u *url.URL) string {
+	c := *u
+	c.RawQuery = ""
+	return c.Redacted()
+}
@@ -0,0 +1,98 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWebhook(t *testing.T) {
+	cases := map[string]struct {
+		url     string
+		id      string
+		token   string
+		str     string
+		wantErr bool
+	}{
+		"webhook": {
+			url:   "https://discord.com/api/webhooks/1234/s3cr3t-t0ken",
+			id:    "1234",
+			token: "s3cr3t-t0ken",
+			str:   "https://discord.com/api/webhooks/1234/REDACTED",
+		},
+		"versioned api with query": {
+			url:   "https://discord.com/api/v10/webhooks/1234/s3cr3t-t0ken/?thread_id=5678",
+			id:    "1234",
+			token: "s3cr3t-t0ken",
+			str:   "https://discord.com/api/v10/webhooks/1234/REDACTED",
+		},
+		"suffix": {
+			url:   "https://discord.com/api/webhooks/1234/s3cr3t-t0ken/slack",
+			id:    "1234",
+			token: "s3cr3t-t0ken",
+			str:   "https://discord.com/api/webhooks/1234/REDACTED/slack",
+		},
+		"proxy": {
+			url:   "https://relay.example.com/hooks/s3cr3t-t0ken",
+			token: "s3cr3t-t0ken",
+			str:   "https://relay.example.com/hooks/REDACTED",
+		},
+		"missing token": {
+			url:     "https://discord.com/api/webhooks/1234",
+			wantErr: true,
+		},
+		"not a webhook": {
+			url:     "https://discord.com/api/s3cr3t-t0ken",
+			wantErr: true,
+		},
+		"invalid": {
+			url:     "https://discord.com/api/webhooks/1234/s3cr3t-t0ken\x7f",
+			wantErr: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseWebhook(c.url)
+			if err != nil && !c.wantErr {
+				t.Fatalf("unexpected error from ParseWebhook:\n\t(ERR): %s", err)
+			} else if err == nil && c.wantErr {
+				t.Fatalf("expected an error from ParseWebhook:\n\t(GOT): nil")
+			} else if err != nil && c.wantErr {
+				if strings.Contains(err.Error(), "s3cr3t-t0ken") {
+					t.Fatalf("unexpected token in error from ParseWebhook:\n\t(ERR): %s", err)
+				}
+				return
+			}
+
+			if got.ID != c.id || got.Token != c.token {
+				t.Fatalf("unexpected Webhook from ParseWebhook:\n\t(GOT): %s/%s\n\t(WNT): %s/%s", got.ID, got.Token, c.id, c.token)
+			}
+			for _, s := range []string{got.String(), fmt.Sprint(got), fmt.Sprintf("%#v", got)} {
+				if strings.Contains(s, c.token) {
+					t.Fatalf("unexpected token in formatted Webhook:\n\t(GOT): %s", s)
+				}
+			}
+			if got.String() != c.str {
+				t.Fatalf("unexpected value from Webhook.String:\n\t(GOT): %s\n\t(WNT): %s", got.String(), c.str)
+			}
+		})
+	}
+}
+
+func TestSendRedacts(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	webhook := testWebhook(t, s)
+	s.Close()
+
+	_, err := (&Client{MaxRetryTime: 100 * time.Millisecond}).Send(context.Background(), webhook, &Message{Content: "concourse"})
+	if err == nil {
+		t.Fatalf("expected an error from Send:\n\t(GOT): nil")
+	} else if strings.Contains(err.Error(), webhook.Token) {
+		t.Fatalf("unexpected token in error from Send:\n\t(ERR): %s", err)
+	}
+}
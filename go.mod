@@ -7,4 +7,5 @@ require (
 	github.com/cenkalti/backoff/v4 v4.3.0
 	github.com/google/go-cmp v0.6.0
 	golang.org/x/oauth2 v0.26.0
+	sigs.k8s.io/yaml v1.4.0
 )
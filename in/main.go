@@ -5,13 +5,46 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
 )
 
+// in writes each key of the version (e.g. message_id and channel_id of a
+// sent message) to a file of the same name in the destination directory.
+func in(input *concourse.InRequest, dest string) (*concourse.InResponse, error) {
+	version := input.Version
+	if len(version) == 0 {
+		version = concourse.Version{"ver": "static"}
+	}
+
+	for k, v := range version {
+		err := os.WriteFile(filepath.Join(dest, k), []byte(v), 0644)
+		if err != nil {
+			return nil, fmt.Errorf("error writing version: %w", err)
+		}
+	}
+
+	return &concourse.InResponse{Version: version}, nil
+}
+
 func main() {
-	err := json.NewEncoder(os.Stdout).Encode(concourse.InResponse{Version: concourse.Version{"ver": "static"}})
+	// The first argument is the path to the destination directory
+	dest := os.Args[1]
+
+	var input *concourse.InRequest
+	err := json.NewDecoder(os.Stdin).Decode(&input)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("error reading stdin: %w", err))
+	}
+
+	o, err := in(input, dest)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(o)
 	if err != nil {
-		log.Fatalln(fmt.Errorf("error: %s", err))
+		log.Fatalln(fmt.Errorf("error writing stdout: %w", err))
 	}
 }
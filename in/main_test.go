@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
+)
+
+func TestIn(t *testing.T) {
+	cases := map[string]struct {
+		version concourse.Version
+		want    concourse.Version
+	}{
+		"static": {
+			want: concourse.Version{"ver": "static"},
+		},
+		"message": {
+			version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+			want:    concourse.Version{"message_id": "1234", "channel_id": "5678"},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			dest := t.TempDir()
+
+			got, err := in(&concourse.InRequest{Version: c.version}, dest)
+			if err != nil {
+				t.Fatalf("unexpected error from in:\n\t(ERR): %s", err)
+			} else if !cmp.Equal(got.Version, c.want) {
+				t.Fatalf("unexpected Version from in:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got.Version, c.want, cmp.Diff(got.Version, c.want))
+			}
+
+			for k, v := range c.want {
+				data, err := os.ReadFile(filepath.Join(dest, k))
+				if err != nil {
+					t.Fatalf("unexpected error reading %s:\n\t(ERR): %s", k, err)
+				} else if string(data) != v {
+					t.Fatalf("unexpected contents of %s:\n\t(GOT): %#v\n\t(WNT): %#v", k, string(data), v)
+				}
+			}
+		})
+	}
+}
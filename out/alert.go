@@ -1,7 +1,13 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
 )
@@ -10,13 +16,47 @@ import (
 type Alert struct {
 	Type        string
 	Color       string
-	IconURL     string
+	Icon        string // Embedded icon of a built-in alert type
+	IconURL     string // Icon of an alert type, instead of Icon
 	Message     string
 	MessageFile string
 	Text        string
 	TextFile    string
+	Description string
 	Disabled    bool
-	Role        string
+	Username    string
+	AvatarURL   string // Overrides the icon as the avatar of the message
+	Icons       string // How embedded icons are sent: attach or url
+	IconBaseURL string // URL the embedded icons are served from
+	Roles       []string
+	Users       []string
+	Everyone    bool
+	Here        bool
+	Attachments []string
+	Overflow    string
+
+	MentionCreatedBy bool
+	DiscordUsers     map[string]string // Discord user IDs by Concourse user
+
+	AlertOnStreak *concourse.StreakPolicy // When repeated results alert, or always if nil
+	Flaky         *concourse.FlakyPolicy  // With defaults, or nil if not detected
+
+	SlowThreshold float64 // Alerts only if slow if set
+	SlowBaseline  string  // p50 or p90
+	SlowBuilds    int
+
+	Fields        []concourse.Field
+	FieldsFile    string
+	ReplaceFields bool
+
+	PayloadFile string
+
+	UpdateMessageFile string
+	DeleteMessage     string
+
+	ThreadID    string
+	ThreadName  string
+	AppliedTags []string
 }
 
 func (alert Alert) ColorToDecimal() (int, error) {
@@ -38,66 +78,149 @@ func (alert Alert) ColorToDecimal() (int, error) {
 	return int(color), nil
 }
 
-// NewAlert constructs and returns an Alert.
-func NewAlert(input *concourse.OutRequest) Alert {
+// username returns the name the alert is sent with.
+func (alert Alert) username() string {
+	if alert.Username == "" {
+		return "Concourse"
+	}
+	return alert.Username
+}
+
+// builtinAlertTypes are the alert types which do not need to be defined in
+// the source's alert_types.
+var builtinAlertTypes = []string{"default", "success", "failed", "started", "aborted", "fixed", "broke", "errored", "still_failing", "still_succeeding", "duration"}
+
+// NewAlert constructs and returns an Alert. Alert types are either built-in
+// or defined in the source's alert_types, which also override built-in types.
+func NewAlert(input *concourse.OutRequest) (Alert, error) {
 	var alert Alert
 	switch input.Params.AlertType {
 	case "success":
 		alert = Alert{
 			Type:    "success",
 			Color:   "#32cd32",
-			IconURL: "https://ci.concourse-ci.org/public/images/favicon-succeeded.png",
+			Icon:    "favicon-succeeded.png",
 			Message: "Success",
 		}
 	case "failed":
 		alert = Alert{
 			Type:    "failed",
 			Color:   "#d00000",
-			IconURL: "https://ci.concourse-ci.org/public/images/favicon-failed.png",
+			Icon:    "favicon-failed.png",
 			Message: "Failed",
 		}
 	case "started":
 		alert = Alert{
 			Type:    "started",
 			Color:   "#f7cd42",
-			IconURL: "https://ci.concourse-ci.org/public/images/favicon-started.png",
+			Icon:    "favicon-started.png",
 			Message: "Started",
 		}
 	case "aborted":
 		alert = Alert{
 			Type:    "aborted",
 			Color:   "#8d4b32",
-			IconURL: "https://ci.concourse-ci.org/public/images/favicon-aborted.png",
+			Icon:    "favicon-aborted.png",
 			Message: "Aborted",
 		}
 	case "fixed":
 		alert = Alert{
 			Type:    "fixed",
 			Color:   "#32cd32",
-			IconURL: "https://ci.concourse-ci.org/public/images/favicon-succeeded.png",
+			Icon:    "favicon-succeeded.png",
 			Message: "Fixed",
 		}
 	case "broke":
 		alert = Alert{
 			Type:    "broke",
 			Color:   "#d00000",
-			IconURL: "https://ci.concourse-ci.org/public/images/favicon-failed.png",
+			Icon:    "favicon-failed.png",
 			Message: "Broke",
 		}
 	case "errored":
 		alert = Alert{
 			Type:    "errored",
 			Color:   "#f5a623",
-			IconURL: "https://ci.concourse-ci.org/public/images/favicon-errored.png",
+			Icon:    "favicon-errored.png",
 			Message: "Errored",
 		}
-	default:
+	case "duration":
+		alert = Alert{
+			Type:    "duration",
+			Color:   "#ff8c00",
+			Icon:    "favicon-started.png",
+			Message: "Slow",
+		}
+	case "still_failing":
+		alert = Alert{
+			Type:    "still_failing",
+			Color:   "#d00000",
+			Icon:    "favicon-failed.png",
+			Message: "Still failing",
+		}
+	case "still_succeeding":
+		alert = Alert{
+			Type:    "still_succeeding",
+			Color:   "#32cd32",
+			Icon:    "favicon-succeeded.png",
+			Message: "Still succeeding",
+		}
+	case "", "default":
 		alert = Alert{
 			Type:    "default",
 			Color:   "#35495c",
-			IconURL: "https://ci.concourse-ci.org/public/images/favicon-pending.png",
+			Icon:    "favicon-pending.png",
 			Message: "",
 		}
+	default:
+		name := input.Params.AlertType
+		if _, ok := input.Source.AlertTypes[name]; !ok {
+			return Alert{}, fmt.Errorf("unknown alert type %q: must be one of %s", name, strings.Join(alertTypes(input.Source), ", "))
+		}
+		alert = Alert{
+			Type:    name,
+			Color:   "#35495c",
+			Icon:    "favicon-pending.png",
+			Message: capitalize(name),
+		}
+	}
+
+	switch input.Source.Icons {
+	case "", iconsAttach, iconsURL:
+		alert.Icons = input.Source.Icons
+	default:
+		return Alert{}, fmt.Errorf("unknown icons %q: must be %q or %q", input.Source.Icons, iconsAttach, iconsURL)
+	}
+	alert.IconBaseURL = input.Source.IconBaseURL
+
+	alert.Username = input.Source.DiscordUsername
+	alert.AvatarURL = input.Source.AvatarURL
+	if custom, ok := input.Source.AlertTypes[alert.Type]; ok {
+		if custom.Color != "" {
+			alert.Color = custom.Color
+		}
+		if custom.IconURL != "" {
+			alert.IconURL = custom.IconURL
+		}
+		if custom.Message != "" {
+			alert.Message = custom.Message
+		}
+		alert.Roles = custom.Roles
+		alert.Users = custom.Users
+		if custom.Username != "" {
+			alert.Username = custom.Username
+		}
+		if custom.AvatarURL != "" {
+			alert.AvatarURL = custom.AvatarURL
+		}
+		alert.MentionCreatedBy = custom.MentionCreatedBy
+		alert.AlertOnStreak = custom.AlertOnStreak
+	}
+	if input.Params.Username != "" {
+		alert.Username = input.Params.Username
+	}
+	if input.Params.AvatarURL != "" {
+		alert.AvatarURL = input.Params.AvatarURL
 	}
 
 	alert.Disabled = input.Params.Disable
@@ -115,10 +238,156 @@ func NewAlert(input *concourse.OutRequest) Alert {
 	}
 
 	if input.Params.Role != "" {
-		alert.Role = input.Params.Role
+		alert.Roles = append(alert.Roles, input.Params.Role)
+	}
+	alert.Roles = append(alert.Roles, input.Params.Roles...)
+	alert.Users = append(alert.Users, input.Params.Users...)
+	alert.Everyone = input.Params.Everyone
+	alert.Here = input.Params.Here
+	if input.Params.MentionCreatedBy {
+		alert.MentionCreatedBy = true
+	}
+	alert.DiscordUsers = input.Source.DiscordUsers
+	if input.Params.AlertOnStreak != nil {
+		alert.AlertOnStreak = input.Params.AlertOnStreak
+	}
+	if _, ok := streakStatuses[alert.Type]; alert.AlertOnStreak != nil && !ok {
+		return Alert{}, fmt.Errorf("alert_on_streak is not supported by alert type %q", alert.Type)
+	}
+	if policy := alert.AlertOnStreak; policy != nil {
+		if len(policy.At) == 0 && policy.Every == 0 {
+			return Alert{}, fmt.Errorf("invalid alert_on_streak: must have at or every")
+		}
+		for _, n := range policy.At {
+			if n <= 0 {
+				return Alert{}, fmt.Errorf("invalid alert_on_streak at %d: must be positive", n)
+			}
+		}
+		if policy.Every < 0 {
+			return Alert{}, fmt.Errorf("invalid alert_on_streak every %d: must be positive", policy.Every)
+		}
+	}
+	alert.SlowThreshold = input.Params.SlowThreshold
+	if alert.SlowThreshold != 0 || alert.Type == "duration" {
+		if alert.Type != "duration" && alert.Type != "success" {
+			return Alert{}, fmt.Errorf("slow_threshold is not supported by alert type %q", alert.Type)
+		}
+		if alert.SlowThreshold == 0 {
+			alert.SlowThreshold = defaultSlowThreshold
+		}
+		if alert.SlowThreshold < 0 {
+			return Alert{}, fmt.Errorf("invalid slow_threshold %v: must be positive", alert.SlowThreshold)
+		}
+
+		alert.SlowBaseline = input.Params.SlowBaseline
+		if alert.SlowBaseline == "" {
+			alert.SlowBaseline = "p90"
+		}
+		if alert.SlowBaseline != "p50" && alert.SlowBaseline != "p90" {
+			return Alert{}, fmt.Errorf("unknown slow_baseline %q: must be %q or %q", alert.SlowBaseline, "p50", "p90")
+		}
+
+		alert.SlowBuilds = input.Params.SlowBuilds
+		if alert.SlowBuilds == 0 {
+			alert.SlowBuilds = defaultSlowBuilds
+		}
+		if alert.SlowBuilds < 0 {
+			return Alert{}, fmt.Errorf("invalid slow_builds %d: must be positive", alert.SlowBuilds)
+		}
+	}
+	if input.Source.Flaky != nil {
+		flaky := *input.Source.Flaky
+		if flaky.Builds == 0 {
+			flaky.Builds = defaultFlakyBuilds
+		}
+		if flaky.Ratio == 0 {
+			flaky.Ratio = defaultFlakyRatio
+		}
+		if flaky.Builds < 3 {
+			return Alert{}, fmt.Errorf("invalid flaky builds %d: must be at least 3", flaky.Builds)
+		}
+		if flaky.Ratio < 0 || flaky.Ratio > 1 {
+			return Alert{}, fmt.Errorf("invalid flaky ratio %v: must be between 0 and 1", flaky.Ratio)
+		}
+		alert.Flaky = &flaky
 	}
 
 	alert.Text = input.Params.Text
 	alert.TextFile = input.Params.TextFile
-	return alert
+	alert.Description = input.Params.Description
+	alert.Fields = input.Params.Fields
+	alert.FieldsFile = input.Params.FieldsFile
+	alert.ReplaceFields = input.Params.ReplaceFields
+	alert.PayloadFile = input.Params.PayloadFile
+	alert.Attachments = input.Params.Attachments
+	alert.Overflow = input.Params.Overflow
+	alert.UpdateMessageFile = input.Params.UpdateMessageFile
+	alert.DeleteMessage = input.Params.DeleteMessage
+
+	alert.ThreadID = input.Source.ThreadID
+	if input.Params.ThreadID != "" {
+		alert.ThreadID = input.Params.ThreadID
+	}
+	alert.ThreadName = input.Source.ThreadName
+	if input.Params.ThreadName != "" {
+		alert.ThreadName = input.Params.ThreadName
+	}
+	alert.AppliedTags = input.Source.AppliedTags[alert.Type]
+	if len(input.Params.AppliedTags) > 0 {
+		alert.AppliedTags = input.Params.AppliedTags
+	}
+	return alert, nil
+}
+
+// mentionCreatedBy adds the Discord user of whoever triggered the build, as
+// mapped by discord_users, to the mentioned users if the alert mentions them.
+func (alert *Alert) mentionCreatedBy(data *templateData) {
+	if !alert.MentionCreatedBy {
+		return
+	}
+	createdBy := data.CreatedBy()
+	if createdBy == "" {
+		return
+	}
+
+	user, ok := alert.DiscordUsers[createdBy]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "error mentioning %s: not in discord_users\nwill not mention them instead\n", createdBy)
+		return
+	}
+	if !slices.Contains(alert.Users, user) {
+		alert.Users = append(slices.Clip(alert.Users), user)
+	}
+}
+
+// markFlaky tags the alert of a flaky job: its color and mentions are
+// replaced by those of the flaky policy, so on-call is not paged.
+func (alert *Alert) markFlaky() {
+	if alert.Flaky.Color != "" {
+		alert.Color = alert.Flaky.Color
+	}
+	alert.Roles = alert.Flaky.Roles
+	alert.Users = alert.Flaky.Users
+	alert.Everyone = false
+	alert.Here = false
+}
+
+// alertTypes returns the names of the built-in alert types and of those
+// defined in the source.
+func alertTypes(source concourse.Source) []string {
+	names := append([]string(nil), builtinAlertTypes...)
+	var custom []string
+	for name := range source.AlertTypes {
+		if !slices.Contains(builtinAlertTypes, name) {
+			custom = append(custom, name)
+		}
+	}
+	slices.Sort(custom)
+	return append(names, custom...)
+}
+
+// capitalize returns s with its first letter in upper case.
+func capitalize(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
 }
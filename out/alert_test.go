@@ -11,62 +11,300 @@ func TestNewAlert(t *testing.T) {
 	cases := map[string]struct {
 		input *concourse.OutRequest
 		want  Alert
+		err   bool
 	}{
 		// Default and overrides.
 		"default": {
 			input: &concourse.OutRequest{},
-			want:  Alert{Type: "default", Color: "#35495c", IconURL: "https://ci.concourse-ci.org/public/images/favicon-pending.png"},
+			want:  Alert{Type: "default", Color: "#35495c", Icon: "favicon-pending.png"},
 		},
 		"custom params": {
 			input: &concourse.OutRequest{
 				Source: concourse.Source{},
-				Params: concourse.OutParams{Color: "#ffffff", Message: "custom-message", Text: "custom-text", Disable: true, Role: "1342563020215291936"},
+				Params: concourse.OutParams{Color: "#ffffff", Message: "custom-message", Text: "custom-text", Disable: true, Role: "1342563020215291936", Roles: []string{"1"}, Users: []string{"2"}, Everyone: true},
 			},
-			want: Alert{Type: "default", Color: "#ffffff", IconURL: "https://ci.concourse-ci.org/public/images/favicon-pending.png", Message: "custom-message", Text: "custom-text", Disabled: true, Role: "1342563020215291936"},
+			want: Alert{Type: "default", Color: "#ffffff", Icon: "favicon-pending.png", Message: "custom-message", Text: "custom-text", Disabled: true, Roles: []string{"1342563020215291936", "1"}, Users: []string{"2"}, Everyone: true},
 		},
 		"custom source": {
 			input: &concourse.OutRequest{
 				Source: concourse.Source{Disable: true},
 			},
-			want: Alert{Type: "default", Color: "#35495c", IconURL: "https://ci.concourse-ci.org/public/images/favicon-pending.png", Disabled: true},
+			want: Alert{Type: "default", Color: "#35495c", Icon: "favicon-pending.png", Disabled: true},
+		},
+		"thread source": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{ThreadName: "$BUILD_PIPELINE_NAME", AppliedTags: map[string][]string{"failed": {"1"}, "fixed": {"2"}}},
+				Params: concourse.OutParams{AlertType: "failed"},
+			},
+			want: Alert{Type: "failed", Color: "#d00000", Icon: "favicon-failed.png", Message: "Failed", ThreadName: "$BUILD_PIPELINE_NAME", AppliedTags: []string{"1"}},
+		},
+		"thread params": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{ThreadID: "10", ThreadName: "$BUILD_PIPELINE_NAME", AppliedTags: map[string][]string{"failed": {"1"}}},
+				Params: concourse.OutParams{AlertType: "failed", ThreadID: "20", ThreadName: "$BUILD_JOB_NAME", AppliedTags: []string{"3"}},
+			},
+			want: Alert{Type: "failed", Color: "#d00000", Icon: "favicon-failed.png", Message: "Failed", ThreadID: "20", ThreadName: "$BUILD_JOB_NAME", AppliedTags: []string{"3"}},
 		},
 		// Alert types.
+		"unknown": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "deployed"}},
+			err:   true,
+		},
+		"custom": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{AlertTypes: map[string]concourse.AlertType{
+					"deployed": {Color: "#0000ff", Roles: []string{"1"}, Username: "Deployer"},
+				}},
+				Params: concourse.OutParams{AlertType: "deployed", Roles: []string{"2"}},
+			},
+			want: Alert{Type: "deployed", Color: "#0000ff", Icon: "favicon-pending.png", Message: "Deployed", Roles: []string{"1", "2"}, Username: "Deployer"},
+		},
+		"custom with non-ascii name": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{AlertTypes: map[string]concourse.AlertType{"échec": {}}},
+				Params: concourse.OutParams{AlertType: "échec"},
+			},
+			want: Alert{Type: "échec", Color: "#35495c", Icon: "favicon-pending.png", Message: "Échec"},
+		},
+		"username and avatar": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{
+					DiscordUsername: "CI",
+					AvatarURL:       "https://example.com/ci.png",
+					AlertTypes:      map[string]concourse.AlertType{"failed": {Username: "CI failures"}},
+				},
+				Params: concourse.OutParams{AlertType: "failed", AvatarURL: "https://example.com/failed.png"},
+			},
+			want: Alert{Type: "failed", Color: "#d00000", Icon: "favicon-failed.png", Message: "Failed", Username: "CI failures", AvatarURL: "https://example.com/failed.png"},
+		},
+		"alert on streak": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{AlertTypes: map[string]concourse.AlertType{"failed": {AlertOnStreak: &concourse.StreakPolicy{At: []int{1}, Every: 5}}}},
+				Params: concourse.OutParams{AlertType: "failed"},
+			},
+			want: Alert{Type: "failed", Color: "#d00000", Icon: "favicon-failed.png", Message: "Failed", AlertOnStreak: &concourse.StreakPolicy{At: []int{1}, Every: 5}},
+		},
+		"alert on streak overridden": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{AlertTypes: map[string]concourse.AlertType{"failed": {AlertOnStreak: &concourse.StreakPolicy{At: []int{1}, Every: 5}}}},
+				Params: concourse.OutParams{AlertType: "failed", AlertOnStreak: &concourse.StreakPolicy{Every: 10}},
+			},
+			want: Alert{Type: "failed", Color: "#d00000", Icon: "favicon-failed.png", Message: "Failed", AlertOnStreak: &concourse.StreakPolicy{Every: 10}},
+		},
+		"alert on streak empty list": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "failed", AlertOnStreak: &concourse.StreakPolicy{At: []int{}}}},
+			err:   true,
+		},
+		"alert on streak empty object": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "failed", AlertOnStreak: &concourse.StreakPolicy{}}},
+			err:   true,
+		},
+		"alert on streak at zero": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "failed", AlertOnStreak: &concourse.StreakPolicy{At: []int{0}}}},
+			err:   true,
+		},
+		"alert on streak at negative": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "failed", AlertOnStreak: &concourse.StreakPolicy{At: []int{1, -2}, Every: 5}}},
+			err:   true,
+		},
+		"alert on streak every negative": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "failed", AlertOnStreak: &concourse.StreakPolicy{Every: -1}}},
+			err:   true,
+		},
+		"alert on streak of alert type invalid": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{AlertTypes: map[string]concourse.AlertType{"failed": {AlertOnStreak: &concourse.StreakPolicy{At: []int{0}}}}},
+				Params: concourse.OutParams{AlertType: "failed"},
+			},
+			err: true,
+		},
+		"alert on streak unsupported": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "started", AlertOnStreak: &concourse.StreakPolicy{Every: 10}}},
+			err:   true,
+		},
+		"flaky": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{Flaky: &concourse.FlakyPolicy{Color: "#9b59b6", Roles: []string{"7"}}},
+				Params: concourse.OutParams{AlertType: "failed"},
+			},
+			want: Alert{Type: "failed", Color: "#d00000", Icon: "favicon-failed.png", Message: "Failed", Flaky: &concourse.FlakyPolicy{Builds: 10, Ratio: 0.5, Color: "#9b59b6", Roles: []string{"7"}}},
+		},
+		"flaky too few builds": {
+			input: &concourse.OutRequest{Source: concourse.Source{Flaky: &concourse.FlakyPolicy{Builds: 2}}},
+			err:   true,
+		},
+		"flaky invalid ratio": {
+			input: &concourse.OutRequest{Source: concourse.Source{Flaky: &concourse.FlakyPolicy{Ratio: 1.5}}},
+			err:   true,
+		},
+		"duration": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "duration"}},
+			want:  Alert{Type: "duration", Color: "#ff8c00", Icon: "favicon-started.png", Message: "Slow", SlowThreshold: 1.5, SlowBaseline: "p90", SlowBuilds: 10},
+		},
+		"slow success": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "success", SlowThreshold: 2, SlowBaseline: "p50", SlowBuilds: 20}},
+			want:  Alert{Type: "success", Color: "#32cd32", Icon: "favicon-succeeded.png", Message: "Success", SlowThreshold: 2, SlowBaseline: "p50", SlowBuilds: 20},
+		},
+		"slow unsupported": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "failed", SlowThreshold: 2}},
+			err:   true,
+		},
+		"slow unknown baseline": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "duration", SlowBaseline: "p99"}},
+			err:   true,
+		},
+		"mention created by": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{
+					DiscordUsers: map[string]string{"alice": "4"},
+					AlertTypes:   map[string]concourse.AlertType{"failed": {MentionCreatedBy: true}},
+				},
+				Params: concourse.OutParams{AlertType: "failed"},
+			},
+			want: Alert{Type: "failed", Color: "#d00000", Icon: "favicon-failed.png", Message: "Failed", MentionCreatedBy: true, DiscordUsers: map[string]string{"alice": "4"}},
+		},
+		"icons": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{Icons: "url", IconBaseURL: "https://example.com/icons"},
+			},
+			want: Alert{Type: "default", Color: "#35495c", Icon: "favicon-pending.png", Icons: "url", IconBaseURL: "https://example.com/icons"},
+		},
+		"unknown icons": {
+			input: &concourse.OutRequest{Source: concourse.Source{Icons: "inline"}},
+			err:   true,
+		},
+		"overridden": {
+			input: &concourse.OutRequest{
+				Source: concourse.Source{AlertTypes: map[string]concourse.AlertType{
+					"failed": {IconURL: "https://example.com/failed.png", Message: "Broken", Users: []string{"3"}, AvatarURL: "https://example.com/avatar.png"},
+				}},
+				Params: concourse.OutParams{AlertType: "failed"},
+			},
+			want: Alert{Type: "failed", Color: "#d00000", Icon: "favicon-failed.png", IconURL: "https://example.com/failed.png", Message: "Broken", Users: []string{"3"}, AvatarURL: "https://example.com/avatar.png"},
+		},
 		"success": {
 			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "success"}},
-			want:  Alert{Type: "success", Color: "#32cd32", IconURL: "https://ci.concourse-ci.org/public/images/favicon-succeeded.png", Message: "Success"},
+			want:  Alert{Type: "success", Color: "#32cd32", Icon: "favicon-succeeded.png", Message: "Success"},
 		},
 		"failed": {
 			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "failed"}},
-			want:  Alert{Type: "failed", Color: "#d00000", IconURL: "https://ci.concourse-ci.org/public/images/favicon-failed.png", Message: "Failed"},
+			want:  Alert{Type: "failed", Color: "#d00000", Icon: "favicon-failed.png", Message: "Failed"},
 		},
 		"started": {
 			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "started"}},
-			want:  Alert{Type: "started", Color: "#f7cd42", IconURL: "https://ci.concourse-ci.org/public/images/favicon-started.png", Message: "Started"},
+			want:  Alert{Type: "started", Color: "#f7cd42", Icon: "favicon-started.png", Message: "Started"},
 		},
 		"aborted": {
 			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "aborted"}},
-			want:  Alert{Type: "aborted", Color: "#8d4b32", IconURL: "https://ci.concourse-ci.org/public/images/favicon-aborted.png", Message: "Aborted"},
+			want:  Alert{Type: "aborted", Color: "#8d4b32", Icon: "favicon-aborted.png", Message: "Aborted"},
 		},
 		"fixed": {
 			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "fixed"}},
-			want:  Alert{Type: "fixed", Color: "#32cd32", IconURL: "https://ci.concourse-ci.org/public/images/favicon-succeeded.png", Message: "Fixed"},
+			want:  Alert{Type: "fixed", Color: "#32cd32", Icon: "favicon-succeeded.png", Message: "Fixed"},
 		},
 		"broke": {
 			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "broke"}},
-			want:  Alert{Type: "broke", Color: "#d00000", IconURL: "https://ci.concourse-ci.org/public/images/favicon-failed.png", Message: "Broke"},
+			want:  Alert{Type: "broke", Color: "#d00000", Icon: "favicon-failed.png", Message: "Broke"},
+		},
+		"still_failing": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "still_failing", AlertOnStreak: &concourse.StreakPolicy{At: []int{2, 5}}}},
+			want:  Alert{Type: "still_failing", Color: "#d00000", Icon: "favicon-failed.png", Message: "Still failing", AlertOnStreak: &concourse.StreakPolicy{At: []int{2, 5}}},
+		},
+		"still_succeeding": {
+			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "still_succeeding"}},
+			want:  Alert{Type: "still_succeeding", Color: "#32cd32", Icon: "favicon-succeeded.png", Message: "Still succeeding"},
 		},
 		"errored": {
 			input: &concourse.OutRequest{Params: concourse.OutParams{AlertType: "errored"}},
-			want:  Alert{Type: "errored", Color: "#f5a623", IconURL: "https://ci.concourse-ci.org/public/images/favicon-errored.png", Message: "Errored"},
+			want:  Alert{Type: "errored", Color: "#f5a623", Icon: "favicon-errored.png", Message: "Errored"},
 		},
 	}
 
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
-			got := NewAlert(c.input)
-			if !cmp.Equal(got, c.want) {
+			got, err := NewAlert(c.input)
+			if err != nil && !c.err {
+				t.Fatalf("unexpected error from NewAlert:\n\t(ERR): %s", err)
+			} else if err == nil && c.err {
+				t.Fatalf("expected an error from NewAlert:\n\t(GOT): nil")
+			} else if !cmp.Equal(got, c.want) {
 				t.Fatalf("unexpected Alert from NewAlert:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
 			}
 		})
 	}
 }
+
+func TestMentionCreatedBy(t *testing.T) {
+	users := map[string]string{"alice": "4", "bob": "5"}
+
+	cases := map[string]struct {
+		alert     Alert
+		createdBy string
+		build     *concourse.Build
+		want      []string
+	}{
+		"from metadata": {
+			alert:     Alert{MentionCreatedBy: true, DiscordUsers: users, Users: []string{"2"}},
+			createdBy: "alice",
+			want:      []string{"2", "4"},
+		},
+		"from build": {
+			alert: Alert{MentionCreatedBy: true, DiscordUsers: users},
+			build: &concourse.Build{CreatedBy: "bob"},
+			want:  []string{"5"},
+		},
+		"already mentioned": {
+			alert:     Alert{MentionCreatedBy: true, DiscordUsers: users, Users: []string{"4"}},
+			createdBy: "alice",
+			want:      []string{"4"},
+		},
+		"not mapped": {
+			alert:     Alert{MentionCreatedBy: true, DiscordUsers: users},
+			createdBy: "carol",
+		},
+		"not triggered manually": {
+			alert: Alert{MentionCreatedBy: true, DiscordUsers: users},
+			build: &concourse.Build{},
+		},
+		"disabled": {
+			alert:     Alert{DiscordUsers: users},
+			createdBy: "alice",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var fetch func() (*concourse.Build, error)
+			if c.build != nil {
+				fetch = func() (*concourse.Build, error) { return c.build, nil }
+			}
+			data := newTemplateData(c.alert.Type, concourse.BuildMetadata{CreatedBy: c.createdBy}, fetch)
+
+			alert := c.alert
+			alert.mentionCreatedBy(data)
+			if !cmp.Equal(alert.Users, c.want) {
+				t.Fatalf("unexpected users from mentionCreatedBy:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", alert.Users, c.want, cmp.Diff(alert.Users, c.want))
+			}
+		})
+	}
+}
+
+func TestMarkFlaky(t *testing.T) {
+	alert := Alert{
+		Color:    "#d00000",
+		Roles:    []string{"1"},
+		Users:    []string{"2"},
+		Everyone: true,
+		Flaky:    &concourse.FlakyPolicy{Color: "#9b59b6", Users: []string{"3"}},
+	}
+	want := Alert{
+		Color: "#9b59b6",
+		Users: []string{"3"},
+		Flaky: alert.Flaky,
+	}
+
+	alert.markFlaky()
+	if !cmp.Equal(alert, want) {
+		t.Fatalf("unexpected Alert from markFlaky:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", alert, want, cmp.Diff(alert, want))
+	}
+}
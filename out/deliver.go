@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
+	"github.com/tklein1801/concourse-discord-alert-resource/discord"
+)
+
+// A target is a webhook an alert is delivered to.
+type target struct {
+	Label   string
+	Webhook *discord.Webhook
+}
+
+// validLabel matches labels which are safe to use in file names.
+var validLabel = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// parseTargets returns the webhooks of the url and urls of the source. Labels
+// default to the webhook's ID, or to webhook-N for other URLs.
+func parseTargets(source concourse.Source) ([]target, error) {
+	urls := source.URLs
+	if source.URL != "" {
+		urls = append([]concourse.WebhookURL{{URL: source.URL}}, urls...)
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("discord webhook url cannot be blank")
+	}
+
+	var targets []target
+	labels := map[string]bool{}
+	for i, u := range urls {
+		if u.URL == "" {
+			return nil, fmt.Errorf("discord webhook url %d cannot be blank", i+1)
+		}
+		webhook, err := discord.ParseWebhook(u.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		label := u.Label
+		if label == "" {
+			label = webhook.ID
+		}
+		if label == "" {
+			label = fmt.Sprintf("webhook-%d", i+1)
+		}
+		if !validLabel.MatchString(label) {
+			return nil, fmt.Errorf("invalid discord webhook label %q: must only contain letters, digits, - and _", label)
+		}
+		if labels[label] {
+			return nil, fmt.Errorf("duplicate discord webhook label %q", label)
+		}
+		labels[label] = true
+
+		targets = append(targets, target{Label: label, Webhook: webhook})
+	}
+	return targets, nil
+}
+
+// A delivery is the outcome of an alert for one target.
+type delivery struct {
+	Target    target
+	Action    string // sent, edited or deleted
+	MessageID string // ID of the deleted message
+	Results   []*discord.Result
+	Err       error
+}
+
+// deliver calls fn for every target concurrently.
+func deliver(targets []target, fn func(target) delivery) []delivery {
+	deliveries := make([]delivery, len(targets))
+
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			deliveries[i] = fn(t)
+			deliveries[i].Target = t
+		}(i, t)
+	}
+	wg.Wait()
+
+	return deliveries
+}
+
+// sendMessages sends the messages of an alert to the target in order. The
+// first message replaces the message with messageID, if set. If the first
+// message created a forum post, the others are sent to it.
+func sendMessages(ctx context.Context, client *discord.Client, t target, messages []*discord.Message, messageID string) delivery {
+	d := delivery{Action: "sent"}
+	if messageID != "" {
+		d.Action = "edited"
+	}
+
+	for i, m := range messages {
+		var result *discord.Result
+		var err error
+		if i == 0 && messageID != "" {
+			result, err = client.Edit(ctx, t.Webhook, messageID, m)
+		} else {
+			if i > 0 && messages[0].ThreadName != "" {
+				// The messages are shared between targets.
+				c := *m
+				c.ThreadID = d.Results[0].Message.ChannelID
+				m = &c
+			}
+			result, err = client.Send(ctx, t.Webhook, m)
+		}
+		if err != nil {
+			d.Err = err
+			return d
+		}
+		d.Results = append(d.Results, result)
+	}
+	return d
+}
+
+// Delivery policies.
+const (
+	deliveryAll = "all" // Fail if any webhook failed
+	deliveryAny = "any" // Fail if every webhook failed
+)
+
+// checkDelivery returns an error if the delivery policy is unknown.
+func checkDelivery(policy string) error {
+	switch policy {
+	case "", deliveryAll, deliveryAny:
+		return nil
+	}
+	return fmt.Errorf("unknown delivery %q: must be %q or %q", policy, deliveryAll, deliveryAny)
+}
+
+// checkDeliveries returns an error describing the failed deliveries if they
+// fail the step according to the policy, which must be known.
+func checkDeliveries(policy string, deliveries []delivery) error {
+	var errs []error
+	for _, d := range deliveries {
+		if d.Err == nil {
+			continue
+		}
+		err := explainError(d.Err)
+		if len(deliveries) > 1 {
+			err = fmt.Errorf("%s: %w", d.Target.Label, err)
+		}
+		errs = append(errs, err)
+	}
+
+	if policy == deliveryAny && len(errs) < len(deliveries) {
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// deliveryOut adds the version and metadata of the deliveries to the
+// response. For a single webhook the version is the first message's ID and
+// channel. For several webhooks each key is suffixed with the webhook's
+// label, e.g. message_id.ops, and each delivery is listed as delivery.ops.
+func deliveryOut(o *concourse.OutResponse, deliveries []delivery) *concourse.OutResponse {
+	if len(deliveries) == 1 {
+		d := deliveries[0]
+		if d.Action == "deleted" {
+			o.Metadata = append(o.Metadata, concourse.Metadata{Name: "deleted", Value: d.MessageID})
+		}
+		if d.Action == "edited" {
+			o.Metadata = append(o.Metadata, concourse.Metadata{Name: "edited", Value: "true"})
+		}
+		if d.Action != "deleted" && len(d.Results) > 0 && d.Results[0].Message.ID != "" {
+			first := d.Results[0].Message
+			o.Version = concourse.Version{"message_id": first.ID, "channel_id": first.ChannelID}
+			o.Metadata = append(o.Metadata, concourse.Metadata{Name: "timestamp", Value: first.Timestamp})
+		}
+		if len(d.Results) > 1 {
+			o.Metadata = append(o.Metadata, concourse.Metadata{Name: "messages", Value: strconv.Itoa(len(d.Results))})
+		}
+		for _, result := range d.Results {
+			o.Metadata = append(o.Metadata, rateLimitMetadata("", result)...)
+		}
+		return o
+	}
+
+	version := concourse.Version{}
+	for _, d := range deliveries {
+		status := fmt.Sprintf("failed: %s", explainError(d.Err))
+		if d.Err == nil {
+			status = d.Action
+			if d.MessageID != "" {
+				status = fmt.Sprintf("%s %s", d.Action, d.MessageID)
+			}
+			if d.Action != "deleted" && len(d.Results) > 0 && d.Results[0].Message.ID != "" {
+				first := d.Results[0].Message
+				version["message_id."+d.Target.Label] = first.ID
+				version["channel_id."+d.Target.Label] = first.ChannelID
+				status = fmt.Sprintf("%s %s", d.Action, first.ID)
+			}
+			if len(d.Results) > 1 {
+				status = fmt.Sprintf("%s (%d messages)", status, len(d.Results))
+			}
+		}
+		// Line breaks of explained errors do not fit a metadata value.
+		status = strings.Join(strings.Fields(status), " ")
+
+		o.Metadata = append(o.Metadata, concourse.Metadata{Name: "delivery." + d.Target.Label, Value: status})
+		for _, result := range d.Results {
+			o.Metadata = append(o.Metadata, rateLimitMetadata(d.Target.Label, result)...)
+		}
+	}
+	if len(version) > 0 {
+		o.Version = version
+	}
+	return o
+}
+
+// targetFile returns the file holding the message ID of the target. With
+// several webhooks the file is suffixed with the webhook's label, as written
+// by a get of the resource.
+func targetFile(file string, t target, targets []target) string {
+	if len(targets) == 1 {
+		return file
+	}
+	return file + "." + t.Label
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
+)
+
+// Defaults of slow alerts.
+const (
+	defaultSlowThreshold = 1.5
+	defaultSlowBuilds    = 10
+)
+
+// slowness is how the duration of the current build compares to the
+// baseline of the job's recent successful builds.
+type slowness struct {
+	Duration time.Duration // Of the current build
+	P50      time.Duration
+	P90      time.Duration
+	Builds   int // Number of successful builds of the baseline
+
+	Baseline  string  // p50 or p90, compared with
+	Threshold float64 // Factor of the baseline the build is slow beyond
+}
+
+// Factor returns the duration of the current build as a factor of the
+// baseline.
+func (s slowness) Factor() float64 {
+	baseline := s.P90
+	if s.Baseline == "p50" {
+		baseline = s.P50
+	}
+	if baseline <= 0 {
+		return 0
+	}
+	return float64(s.Duration) / float64(baseline)
+}
+
+// Slow returns whether the build regressed beyond the threshold.
+func (s slowness) Slow() bool {
+	return s.Builds > 0 && s.Factor() > s.Threshold
+}
+
+// String describes the slowness, e.g. "took 12m3s, 2.4x the p90 of 5m2s
+// (p50 4m10s) of the last 10 successful builds".
+func (s slowness) String() string {
+	if s.Builds == 0 {
+		return fmt.Sprintf("took %s, with no successful builds to compare with", formatDuration(s.Duration))
+	}
+
+	baseline, other, otherName := s.P90, s.P50, "p50"
+	if s.Baseline == "p50" {
+		baseline, other, otherName = s.P50, s.P90, "p90"
+	}
+	return fmt.Sprintf(
+		"took %s, %.1fx the %s of %s (%s %s) of the last %d successful builds",
+		formatDuration(s.Duration), s.Factor(), s.Baseline, formatDuration(baseline), otherName, formatDuration(other), s.Builds,
+	)
+}
+
+// jobSlowness compares the duration of the current build with the last
+// SlowBuilds successful builds of history.
+func jobSlowness(alert Alert, build *concourse.Build, history []concourse.Build) slowness {
+	var durations []time.Duration
+	for _, b := range history {
+		if len(durations) == alert.SlowBuilds {
+			break
+		}
+		if b.Status == "succeeded" && b.StartTime != 0 && b.EndTime != 0 {
+			durations = append(durations, b.DurationAt(now()))
+		}
+	}
+	slices.Sort(durations)
+
+	return slowness{
+		Duration:  build.DurationAt(now()),
+		P50:       percentile(durations, 0.5),
+		P90:       percentile(durations, 0.9),
+		Builds:    len(durations),
+		Baseline:  alert.SlowBaseline,
+		Threshold: alert.SlowThreshold,
+	}
+}
+
+// percentile returns the p-th percentile of the sorted durations by the
+// nearest rank, or 0 if there are none.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
+)
+
+func TestJobSlowness(t *testing.T) {
+	history := []concourse.Build{
+		{Status: "succeeded", StartTime: 1000, EndTime: 1300},
+		{Status: "failed", StartTime: 900, EndTime: 990},
+		{Status: "succeeded", StartTime: 800, EndTime: 1040},
+		{Status: "aborted", StartTime: 700},
+		{Status: "succeeded", StartTime: 100, EndTime: 700},
+	}
+	build := &concourse.Build{StartTime: 2000, EndTime: 2720}
+
+	cases := map[string]struct {
+		alert   Alert
+		build   *concourse.Build
+		history []concourse.Build
+		want    slowness
+		slow    bool
+		str     string
+	}{
+		"within threshold": {
+			alert:   Alert{SlowThreshold: 1.5, SlowBaseline: "p90", SlowBuilds: 10},
+			build:   build,
+			history: history,
+			want:    slowness{Duration: 12 * time.Minute, P50: 5 * time.Minute, P90: 10 * time.Minute, Builds: 3, Baseline: "p90", Threshold: 1.5},
+			slow:    false,
+			str:     "took 12m0s, 1.2x the p90 of 10m0s (p50 5m0s) of the last 3 successful builds",
+		},
+		"p50": {
+			alert:   Alert{SlowThreshold: 1.5, SlowBaseline: "p50", SlowBuilds: 10},
+			build:   build,
+			history: history,
+			want:    slowness{Duration: 12 * time.Minute, P50: 5 * time.Minute, P90: 10 * time.Minute, Builds: 3, Baseline: "p50", Threshold: 1.5},
+			slow:    true,
+			str:     "took 12m0s, 2.4x the p50 of 5m0s (p90 10m0s) of the last 3 successful builds",
+		},
+		"last builds": {
+			alert:   Alert{SlowThreshold: 2, SlowBaseline: "p90", SlowBuilds: 2},
+			build:   build,
+			history: history,
+			want:    slowness{Duration: 12 * time.Minute, P50: 4 * time.Minute, P90: 5 * time.Minute, Builds: 2, Baseline: "p90", Threshold: 2},
+			slow:    true,
+			str:     "took 12m0s, 2.4x the p90 of 5m0s (p50 4m0s) of the last 2 successful builds",
+		},
+		"running": {
+			alert:   Alert{SlowThreshold: 1.5, SlowBaseline: "p90", SlowBuilds: 10},
+			build:   &concourse.Build{StartTime: 2000},
+			history: history,
+			want:    slowness{Duration: 20 * time.Minute, P50: 5 * time.Minute, P90: 10 * time.Minute, Builds: 3, Baseline: "p90", Threshold: 1.5},
+			slow:    true,
+			str:     "took 20m0s, 2.0x the p90 of 10m0s (p50 5m0s) of the last 3 successful builds",
+		},
+		"no successful builds": {
+			alert: Alert{SlowThreshold: 1.5, SlowBaseline: "p90", SlowBuilds: 10},
+			build: build,
+			want:  slowness{Duration: 12 * time.Minute, Baseline: "p90", Threshold: 1.5},
+			slow:  false,
+			str:   "took 12m0s, with no successful builds to compare with",
+		},
+	}
+
+	now = func() time.Time { return time.Unix(3200, 0) }
+	defer func() { now = time.Now }()
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := jobSlowness(c.alert, c.build, c.history)
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected slowness from jobSlowness:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			}
+			if got.Slow() != c.slow {
+				t.Fatalf("unexpected value from slowness.Slow:\n\t(GOT): %#v\n\t(WNT): %#v", got.Slow(), c.slow)
+			}
+			if got.String() != c.str {
+				t.Fatalf("unexpected value from slowness.String:\n\t(GOT): %#v\n\t(WNT): %#v", got.String(), c.str)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	durations := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	cases := map[string]struct {
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		"p50":    {sorted: durations, p: 0.5, want: 5},
+		"p90":    {sorted: durations, p: 0.9, want: 9},
+		"single": {sorted: durations[:1], p: 0.9, want: 1},
+		"none":   {p: 0.5, want: 0},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := percentile(c.sorted, c.p)
+			if got != c.want {
+				t.Fatalf("unexpected value from percentile:\n\t(GOT): %#v\n\t(WNT): %#v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
+)
+
+// historyLimit is how many of the job's most recent builds are looked up.
+const historyLimit = 100
+
+// finishedStatuses are the statuses of builds which have ended.
+var finishedStatuses = []string{"succeeded", "failed", "errored", "aborted"}
+
+// defaultSkipStatuses are the statuses of previous builds skipped by fixed
+// and broke, since they tell nothing about whether the job worked.
+var defaultSkipStatuses = []string{"aborted", "errored"}
+
+// A jobHistory returns the finished builds of the job older than the current
+// build, most recent first.
+type jobHistory func() ([]concourse.Build, error)
+
+// newJobHistory returns the jobHistory of the current build, requested from
+// Concourse once it is first used.
+func newJobHistory(input *concourse.OutRequest, m concourse.BuildMetadata) jobHistory {
+	return sync.OnceValues(func() ([]concourse.Build, error) {
+		return fetchJobHistory(input, m)
+	})
+}
+
+// fetchJobHistory requests the job's last historyLimit builds from Concourse
+// and returns those older than the current build.
+func fetchJobHistory(input *concourse.OutRequest, m concourse.BuildMetadata) ([]concourse.Build, error) {
+	if m.BuildName == "" {
+		return nil, errors.New("BUILD_NAME is not set")
+	}
+
+	c, err := concourse.NewClient(m.Host, m.TeamName, input.Source.Username, input.Source.Password)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to Concourse: %w", err)
+	}
+
+	builds, err := c.JobBuilds(m.PipelineName, m.JobName, m.InstanceVars, historyLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting Concourse builds: %w", err)
+	}
+	return olderBuilds(builds, m)
+}
+
+// olderBuilds returns the finished builds listed after the current build,
+// found by its ID or else its name. Concourse lists reruns next to the build
+// they rerun, so they are compared with the builds before it. An error is
+// returned if the current build is not listed, since its history is unknown.
+func olderBuilds(builds []concourse.Build, m concourse.BuildMetadata) ([]concourse.Build, error) {
+	id, _ := strconv.Atoi(m.ID)
+
+	for i, b := range builds {
+		if (id != 0 && b.ID != id) || (id == 0 && b.Name != m.BuildName) {
+			continue
+		}
+
+		var older []concourse.Build
+		for _, b := range builds[i+1:] {
+			if slices.Contains(finishedStatuses, b.Status) {
+				older = append(older, b)
+			}
+		}
+		return older, nil
+	}
+	return nil, fmt.Errorf("build %s is not among the last %d builds of the job", m.BuildName, len(builds))
+}
+
+// skipStatuses returns the statuses of previous builds to skip from the
+// source, or the default ones.
+func skipStatuses(source concourse.Source) ([]string, error) {
+	if source.SkipStatuses == nil {
+		return defaultSkipStatuses, nil
+	}
+	for _, status := range source.SkipStatuses {
+		if !slices.Contains(finishedStatuses, status) {
+			return nil, fmt.Errorf("unknown status %q in skip_statuses: must be one of %q", status, finishedStatuses)
+		}
+	}
+	return source.SkipStatuses, nil
+}
+
+// previousBuildStatus returns the status of the most recent finished build
+// of the job before the current one, skipping those with skip_statuses, or
+// "" if there is none.
+func previousBuildStatus(source concourse.Source, jh jobHistory) (string, error) {
+	skip, err := skipStatuses(source)
+	if err != nil {
+		return "", err
+	}
+
+	history, err := jh()
+	if err != nil {
+		return "", err
+	}
+
+	for _, b := range history {
+		if !slices.Contains(skip, b.Status) {
+			return b.Status, nil
+		}
+	}
+	return "", nil
+}
+
+// streakStatuses are the statuses of the builds in a streak by alert type.
+var streakStatuses = map[string]string{
+	"success":          "succeeded",
+	"failed":           "failed",
+	"errored":          "errored",
+	"still_failing":    "failed",
+	"still_succeeding": "succeeded",
+}
+
+// A streak is the current build and the builds before it with the same
+// status.
+type streak struct {
+	Status string           // Status of the builds, e.g. failed
+	Count  int              // Number of builds, including the current one
+	Since  *concourse.Build // Oldest build of the streak, or nil if only the current one
+}
+
+// String describes the streak, e.g. "failing for 7 builds since 2026-10-12
+// (build #231)".
+func (s streak) String() string {
+	verb := map[string]string{"failed": "failing", "succeeded": "succeeding", "errored": "erroring"}[s.Status]
+	if s.Since == nil {
+		return fmt.Sprintf("%s for %d build", verb, s.Count)
+	}
+
+	started := s.Since.Started()
+	if started.IsZero() {
+		return fmt.Sprintf("%s for %d builds since build #%s", verb, s.Count, s.Since.Name)
+	}
+	return fmt.Sprintf("%s for %d builds since %s (build #%s)", verb, s.Count, started.UTC().Format(time.DateOnly), s.Since.Name)
+}
+
+// currentStreak returns the streak of builds with status, counting the
+// current build and the most recent builds of history, skipping those with
+// other skip statuses.
+func currentStreak(history []concourse.Build, status string, skip []string) streak {
+	s := streak{Status: status, Count: 1}
+	for i, b := range history {
+		if b.Status != status {
+			if slices.Contains(skip, b.Status) {
+				continue
+			}
+			break
+		}
+		s.Count++
+		s.Since = &history[i]
+	}
+	return s
+}
+
+// jobStreak returns the current streak of the job with the status of the
+// alert type, which must be in streakStatuses.
+func jobStreak(source concourse.Source, jh jobHistory, atype string) (streak, error) {
+	skip, err := skipStatuses(source)
+	if err != nil {
+		return streak{}, err
+	}
+
+	history, err := jh()
+	if err != nil {
+		return streak{}, err
+	}
+	return currentStreak(history, streakStatuses[atype], skip), nil
+}
+
+// Defaults of the flaky policy.
+const (
+	defaultFlakyBuilds = 10
+	defaultFlakyRatio  = 0.5
+)
+
+// flakyAlertTypes are the alert types of failures which are tagged if the
+// job is flaky.
+var flakyAlertTypes = []string{"failed", "broke", "still_failing"}
+
+// flakiness is how often the result of a job changed in its recent builds.
+type flakiness struct {
+	Changes int // Number of builds whose result differs from the one before
+	Builds  int // Number of succeeded and failed builds looked at
+}
+
+// String describes the flakiness, e.g. "result changed 6 times in the last
+// 10 builds".
+func (f flakiness) String() string {
+	return fmt.Sprintf("result changed %d times in the last %d builds", f.Changes, f.Builds)
+}
+
+// jobFlakiness returns the flakiness of the last n succeeded or failed
+// builds of history.
+func jobFlakiness(history []concourse.Build, n int) flakiness {
+	var results []string
+	for _, b := range history {
+		if len(results) == n {
+			break
+		}
+		if b.Status == "succeeded" || b.Status == "failed" {
+			results = append(results, b.Status)
+		}
+	}
+
+	f := flakiness{Builds: len(results)}
+	for i := 1; i < len(results); i++ {
+		if results[i] != results[i-1] {
+			f.Changes++
+		}
+	}
+	return f
+}
+
+// flaky returns whether the builds looked at are as many as those of the
+// policy and changed result at least as often as its ratio.
+func (f flakiness) flaky(policy *concourse.FlakyPolicy) bool {
+	if f.Builds < policy.Builds {
+		return false
+	}
+	return float64(f.Changes)/float64(f.Builds-1) >= policy.Ratio
+}
+
+// detectFlaky returns the flakiness of the job if the alert is of a failure
+// and the job is flaky by its policy, or nil. Jobs whose history cannot be
+// requested are alerted as usual.
+func detectFlaky(alert Alert, jh jobHistory) *flakiness {
+	if alert.Flaky == nil || !slices.Contains(flakyAlertTypes, alert.Type) {
+		return nil
+	}
+
+	history, err := jh()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error detecting flaky job: %v\nwill alert as usual instead\n", err)
+		return nil
+	}
+
+	f := jobFlakiness(history, alert.Flaky.Builds)
+	if !f.flaky(alert.Flaky) {
+		return nil
+	}
+	return &f
+}
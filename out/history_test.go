@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
+)
+
+func TestOlderBuilds(t *testing.T) {
+	builds := []concourse.Build{
+		{ID: 15, Name: "11", Status: "pending"},
+		{ID: 14, Name: "10.1", Status: "started"},
+		{ID: 13, Name: "10", Status: "failed"},
+		{ID: 12, Name: "9", Status: "aborted"},
+		{ID: 11, Name: "8", Status: "succeeded"},
+	}
+
+	cases := map[string]struct {
+		metadata concourse.BuildMetadata
+		want     []concourse.Build
+		err      bool
+	}{
+		"by id": {
+			metadata: concourse.BuildMetadata{ID: "14", BuildName: "10.1"},
+			want:     builds[2:],
+		},
+		"by name": {
+			metadata: concourse.BuildMetadata{BuildName: "10.1"},
+			want:     builds[2:],
+		},
+		"skips unfinished": {
+			metadata: concourse.BuildMetadata{ID: "15", BuildName: "11"},
+			want:     builds[2:],
+		},
+		"oldest": {
+			metadata: concourse.BuildMetadata{ID: "11", BuildName: "8"},
+		},
+		"not listed": {
+			metadata: concourse.BuildMetadata{ID: "2", BuildName: "1"},
+			err:      true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := olderBuilds(builds, c.metadata)
+			if err != nil && !c.err {
+				t.Fatalf("unexpected error from olderBuilds:\n\t(ERR): %s", err)
+			} else if err == nil && c.err {
+				t.Fatalf("expected an error from olderBuilds:\n\t(GOT): %#v", got)
+			} else if err != nil && c.err {
+				return
+			}
+
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected builds from olderBuilds:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			}
+		})
+	}
+}
+
+func TestSkipStatuses(t *testing.T) {
+	cases := map[string]struct {
+		source concourse.Source
+		want   []string
+		err    bool
+	}{
+		"default": {
+			want: []string{"aborted", "errored"},
+		},
+		"none": {
+			source: concourse.Source{SkipStatuses: []string{}},
+			want:   []string{},
+		},
+		"configured": {
+			source: concourse.Source{SkipStatuses: []string{"aborted"}},
+			want:   []string{"aborted"},
+		},
+		"unknown": {
+			source: concourse.Source{SkipStatuses: []string{"pending"}},
+			err:    true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := skipStatuses(c.source)
+			if err != nil && !c.err {
+				t.Fatalf("unexpected error from skipStatuses:\n\t(ERR): %s", err)
+			} else if err == nil && c.err {
+				t.Fatalf("expected an error from skipStatuses:\n\t(GOT): nil")
+			} else if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected statuses from skipStatuses:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			}
+		})
+	}
+}
+
+func TestCurrentStreak(t *testing.T) {
+	history := []concourse.Build{
+		{ID: 14, Name: "10", Status: "failed"},
+		{ID: 13, Name: "9", Status: "aborted"},
+		{ID: 12, Name: "8", Status: "failed"},
+		{ID: 11, Name: "7", Status: "succeeded"},
+		{ID: 10, Name: "6", Status: "failed"},
+	}
+
+	cases := map[string]struct {
+		history []concourse.Build
+		status  string
+		skip    []string
+		want    streak
+	}{
+		"skipping aborted": {
+			history: history,
+			status:  "failed",
+			skip:    []string{"aborted"},
+			want:    streak{Status: "failed", Count: 3, Since: &history[2]},
+		},
+		"broken by aborted": {
+			history: history,
+			status:  "failed",
+			want:    streak{Status: "failed", Count: 2, Since: &history[0]},
+		},
+		"skipped status": {
+			history: []concourse.Build{{Name: "3", Status: "errored"}, {Name: "2", Status: "errored"}, {Name: "1", Status: "failed"}},
+			status:  "errored",
+			skip:    []string{"aborted", "errored"},
+			want:    streak{Status: "errored", Count: 3, Since: &concourse.Build{Name: "2", Status: "errored"}},
+		},
+		"only current": {
+			history: history,
+			status:  "succeeded",
+			want:    streak{Status: "succeeded", Count: 1},
+		},
+		"first build": {
+			status: "failed",
+			want:   streak{Status: "failed", Count: 1},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := currentStreak(c.history, c.status, c.skip)
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected streak from currentStreak:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			}
+		})
+	}
+}
+
+func TestStreakString(t *testing.T) {
+	since := int(time.Date(2026, 10, 12, 3, 0, 0, 0, time.UTC).Unix())
+
+	cases := map[string]struct {
+		streak streak
+		want   string
+	}{
+		"failing": {
+			streak: streak{Status: "failed", Count: 7, Since: &concourse.Build{Name: "231", StartTime: since}},
+			want:   "failing for 7 builds since 2026-10-12 (build #231)",
+		},
+		"succeeding": {
+			streak: streak{Status: "succeeded", Count: 2, Since: &concourse.Build{Name: "5.1", StartTime: since}},
+			want:   "succeeding for 2 builds since 2026-10-12 (build #5.1)",
+		},
+		"not started": {
+			streak: streak{Status: "failed", Count: 3, Since: &concourse.Build{Name: "8"}},
+			want:   "failing for 3 builds since build #8",
+		},
+		"only current": {
+			streak: streak{Status: "failed", Count: 1},
+			want:   "failing for 1 build",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := c.streak.String()
+			if got != c.want {
+				t.Fatalf("unexpected value from streak.String:\n\t(GOT): %#v\n\t(WNT): %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestDetectFlaky(t *testing.T) {
+	alternating := []concourse.Build{
+		{Status: "failed"},
+		{Status: "succeeded"},
+		{Status: "aborted"},
+		{Status: "failed"},
+		{Status: "succeeded"},
+		{Status: "succeeded"},
+	}
+	policy := &concourse.FlakyPolicy{Builds: 4, Ratio: 0.5}
+
+	cases := map[string]struct {
+		alert   Alert
+		history []concourse.Build
+		err     error
+		want    *flakiness
+	}{
+		"flaky": {
+			alert:   Alert{Type: "failed", Flaky: policy},
+			history: alternating,
+			want:    &flakiness{Changes: 3, Builds: 4},
+		},
+		"below ratio": {
+			alert:   Alert{Type: "failed", Flaky: &concourse.FlakyPolicy{Builds: 5, Ratio: 0.8}},
+			history: alternating,
+		},
+		"too few builds": {
+			alert:   Alert{Type: "broke", Flaky: &concourse.FlakyPolicy{Builds: 6, Ratio: 0.5}},
+			history: alternating,
+		},
+		"stable": {
+			alert:   Alert{Type: "failed", Flaky: policy},
+			history: []concourse.Build{{Status: "failed"}, {Status: "failed"}, {Status: "succeeded"}, {Status: "succeeded"}},
+		},
+		"not a failure": {
+			alert:   Alert{Type: "success", Flaky: policy},
+			history: alternating,
+		},
+		"not detected": {
+			alert:   Alert{Type: "failed"},
+			history: alternating,
+		},
+		"unknown history": {
+			alert: Alert{Type: "failed", Flaky: policy},
+			err:   errors.New("unreachable"),
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := detectFlaky(c.alert, func() ([]concourse.Build, error) { return c.history, c.err })
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected flakiness from detectFlaky:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			}
+		})
+	}
+}
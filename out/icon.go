@@ -0,0 +1,44 @@
+package main
+
+import (
+	"embed"
+	"strings"
+
+	"github.com/tklein1801/concourse-discord-alert-resource/discord"
+)
+
+// icons are the icons of the built-in alert types, named like those served
+// by Concourse under /public/images.
+//
+//go:embed icons/*.png
+var icons embed.FS
+
+// How the icons of built-in alert types are sent.
+const (
+	iconsAttach = "attach" // Uploaded with the alert as the embed's thumbnail
+	iconsURL    = "url"    // Linked as the avatar from IconBaseURL
+)
+
+// icon returns the URL of the alert's icon and, if it is uploaded with the
+// alert, its file. host is the external URL of Concourse, which serves the
+// icons by default.
+func (alert Alert) icon(host string) (string, *discord.Attachment) {
+	if alert.IconURL != "" || alert.Icon == "" {
+		return alert.IconURL, nil
+	}
+
+	if alert.Icons == iconsURL {
+		base := alert.IconBaseURL
+		if base == "" {
+			base = host + "/public/images"
+		}
+		return strings.TrimSuffix(base, "/") + "/" + alert.Icon, nil
+	}
+
+	data, err := icons.ReadFile("icons/" + alert.Icon)
+	if err != nil {
+		// Only built-in alert types have an Icon, which are all embedded.
+		return "", nil
+	}
+	return "attachment://" + alert.Icon, &discord.Attachment{Filename: alert.Icon, Data: data}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
+)
+
+func TestIcon(t *testing.T) {
+	cases := map[string]struct {
+		alert    Alert
+		want     string
+		attached bool
+	}{
+		"attach": {
+			alert:    Alert{Icon: "favicon-failed.png"},
+			want:     "attachment://favicon-failed.png",
+			attached: true,
+		},
+		"url": {
+			alert: Alert{Icon: "favicon-failed.png", Icons: "url"},
+			want:  "https://ci.example.com/public/images/favicon-failed.png",
+		},
+		"base url": {
+			alert: Alert{Icon: "favicon-failed.png", Icons: "url", IconBaseURL: "https://example.com/icons/"},
+			want:  "https://example.com/icons/favicon-failed.png",
+		},
+		"icon url": {
+			alert: Alert{Icon: "favicon-failed.png", IconURL: "https://example.com/failed.png"},
+			want:  "https://example.com/failed.png",
+		},
+		"no icon": {
+			alert: Alert{},
+			want:  "",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, file := c.alert.icon("https://ci.example.com")
+			if got != c.want {
+				t.Fatalf("unexpected URL from icon:\n\t(GOT): %q\n\t(WNT): %q", got, c.want)
+			} else if c.attached && (file == nil || file.Filename != c.alert.Icon || len(file.Data) == 0) {
+				t.Fatalf("unexpected file from icon:\n\t(GOT): %#v", file)
+			} else if !c.attached && file != nil {
+				t.Fatalf("unexpected file from icon:\n\t(GOT): %#v\n\t(WNT): nil", file)
+			}
+		})
+	}
+}
+
+// TestIconsEmbedded checks that the icon of every built-in alert type is
+// embedded.
+func TestIconsEmbedded(t *testing.T) {
+	for _, name := range builtinAlertTypes {
+		alert, err := NewAlert(&concourse.OutRequest{Params: concourse.OutParams{AlertType: name}})
+		if err != nil {
+			t.Fatalf("unexpected error from NewAlert:\n\t(ERR): %s", err)
+		}
+		if _, err := icons.ReadFile("icons/" + alert.Icon); err != nil {
+			t.Fatalf("icon of alert type %q is not embedded:\n\t(ERR): %s", name, err)
+		}
+	}
+}
@@ -1,23 +1,32 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
 	"github.com/tklein1801/concourse-discord-alert-resource/discord"
+	"sigs.k8s.io/yaml"
 )
 
-func buildMessage(alert Alert, m concourse.BuildMetadata, path string) *discord.Message {
-	message := alert.Message
-	text := alert.Text
+// buildMessage builds the Discord message of the alert. The message, text,
+// description and field values are rendered as templates with data; the
+// contents of message_file and text_file are used as is.
+func buildMessage(alert Alert, data *templateData, path string) *discord.Message {
+	m := data.BuildMetadata
+	message := render("message", alert.Message, data)
+	text := render("text", alert.Text, data)
 
 	// Open and read message file if set
 	if alert.MessageFile != "" {
@@ -43,6 +52,16 @@ func buildMessage(alert Alert, m concourse.BuildMetadata, path string) *discord.
 		}
 	}
 
+	description := fmt.Sprintf("The execution of task `%s` in pipeline `%s` ended with status `%s`.", m.JobName, m.PipelineName, alert.Type)
+	if alert.Description != "" {
+		description = render("description", alert.Description, data)
+	}
+
+	// Only the configured mentions may ping.
+	message = discord.EscapeMentions(message)
+	text = discord.EscapeMentions(text)
+	description = discord.EscapeMentions(description)
+
 	convColor, err := alert.ColorToDecimal()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error converting color to decimal: %v\nwill default to 0 instead\n", err)
@@ -52,103 +71,275 @@ func buildMessage(alert Alert, m concourse.BuildMetadata, path string) *discord.
 	embeds := []discord.Embed{
 		{
 			Title:       fmt.Sprintf("%s%s", message, text),
-			Description: fmt.Sprintf("The execution of task `%s` in pipeline `%s` ended with status `%s`.", m.JobName, m.PipelineName, alert.Type),
+			Description: description,
 			Color:       convColor,
 			URL:         m.URL,
-			Fields: []discord.Field{
-				{
-					Name:   "Step",
-					Value:  fmt.Sprintf("`%s/%s`", m.PipelineName, m.JobName),
-					Inline: true,
-				},
-				{
-					Name:   "Build",
-					Value:  fmt.Sprintf("`%s`", m.BuildName),
-					Inline: true,
-				},
-			},
+			Timestamp:   now().UTC().Format(time.RFC3339),
+			Fields:      buildFields(alert, data, path),
 		},
 	}
 
+	if createdBy := data.CreatedBy(); createdBy != "" {
+		embeds[0].Author = &discord.Author{Name: "Triggered by " + discord.EscapeMentions(createdBy)}
+	}
+
+	// Icons uploaded with the alert cannot be avatars.
+	avatarURL := render("avatar_url", alert.AvatarURL, data)
+	iconURL, iconFile := alert.icon(m.Host)
+	if iconFile != nil {
+		embeds[0].Thumbnail = &discord.Thumbnail{URL: iconURL}
+	} else if avatarURL == "" {
+		avatarURL = iconURL
+	}
+
 	msg := &discord.Message{
-		Username:  "Concourse",
-		AvatarURL: alert.IconURL,
+		Username:  render("username", alert.username(), data),
+		AvatarURL: avatarURL,
 		Embeds:    embeds,
 	}
+	msg.Content, msg.AllowedMentions = mentions(alert)
 
-	if alert.Role != "" {
-		msg.Content = fmt.Sprintf("<@&%s>", alert.Role)
+	msg.Files = readAttachments(path, alert.Attachments)
+	if iconFile != nil {
+		msg.Files = append(msg.Files, *iconFile)
 	}
 
+	msg.ThreadID = alert.ThreadID
+	msg.ThreadName = render("thread_name", alert.ThreadName, data)
+	msg.AppliedTags = alert.AppliedTags
 	return msg
 }
 
-func previousBuildStatus(input *concourse.OutRequest, m concourse.BuildMetadata) (string, error) {
-	// Exit early if first build
-	if m.BuildName == "1" {
-		return "", nil
+// buildFields returns the default fields of the alert (see buildTimeFields,
+// and the streak, flaky and baseline fields) unless replaced, followed by the
+// fields of the params and of the fields file. The values of the params are
+// rendered as templates.
+func buildFields(alert Alert, data *templateData, path string) []discord.Field {
+	m := data.BuildMetadata
+
+	var fields []discord.Field
+	if !alert.ReplaceFields {
+		fields = append(fields,
+			discord.Field{
+				Name:   "Step",
+				Value:  fmt.Sprintf("`%s/%s`", m.PipelineName, m.JobName),
+				Inline: true,
+			},
+			discord.Field{
+				Name:   "Build",
+				Value:  fmt.Sprintf("`%s`", m.BuildName),
+				Inline: true,
+			},
+		)
+		fields = append(fields, buildTimeFields(data.Build())...)
+		if data.Streak != nil && data.Streak.Since != nil {
+			fields = append(fields, discord.Field{Name: "Streak", Value: data.Streak.String()})
+		}
+		if data.Flaky != nil {
+			fields = append(fields, discord.Field{Name: "🔁 flaky", Value: data.Flaky.String()})
+		}
+		if data.Slow != nil {
+			fields = append(fields, discord.Field{Name: "Baseline", Value: data.Slow.String()})
+		}
 	}
 
-	c, err := concourse.NewClient(m.Host, m.TeamName, input.Source.Username, input.Source.Password)
-	if err != nil {
-		return "", fmt.Errorf("error connecting to Concourse: %w", err)
+	for _, f := range alert.Fields {
+		fields = append(fields, discord.Field{
+			Name:   render("field name", f.Name, data),
+			Value:  render(fmt.Sprintf("%s field", f.Name), f.Value, data),
+			Inline: f.Inline,
+		})
 	}
+	fields = append(fields, readFields(path, alert.FieldsFile)...)
+
+	// Discord rejects fields without a name or value.
+	var valid []discord.Field
+	for _, f := range fields {
+		if strings.TrimSpace(f.Name) == "" || strings.TrimSpace(f.Value) == "" {
+			fmt.Fprintf(os.Stderr, "field %q has no name or value\nwill be skipped\n", f.Name)
+			continue
+		}
+		f.Name = discord.EscapeMentions(f.Name)
+		f.Value = discord.EscapeMentions(f.Value)
+		valid = append(valid, f)
+	}
+	return valid
+}
 
-	p, err := previousBuildName(m.BuildName)
-	if err != nil {
-		return "", fmt.Errorf("error parsing build name: %w", err)
+// buildTimeFields returns the fields with the duration of the build and
+// when it started and ended, shown relative to the reader's time. No fields
+// are returned for a build which has not started or could not be fetched.
+func buildTimeFields(build *concourse.Build) []discord.Field {
+	started := build.Started()
+	if started.IsZero() {
+		return nil
 	}
 
-	instanceVars := ""
-	instanceVarsIndex := strings.Index(m.URL, "?")
-	if instanceVarsIndex > -1 {
-		instanceVars = m.URL[instanceVarsIndex:]
+	ended := build.Ended()
+	fields := []discord.Field{
+		{Name: "Duration", Value: fmt.Sprintf("`%s`", formatDuration(build.DurationAt(now()))), Inline: true},
+		{Name: "Started", Value: fmt.Sprintf("<t:%d:R>", started.Unix()), Inline: true},
+	}
+	if !ended.IsZero() {
+		fields = append(fields, discord.Field{Name: "Ended", Value: fmt.Sprintf("<t:%d:R>", ended.Unix()), Inline: true})
+	}
+	return fields
+}
+
+// readFields reads a JSON or YAML list of fields, e.g. written by a task,
+// from a file relative to the build's sources. No fields are returned if the
+// file is not set or cannot be read.
+func readFields(path, file string) []discord.Field {
+	if file == "" {
+		return nil
 	}
 
-	previous, err := c.JobBuild(m.PipelineName, m.JobName, p, instanceVars)
+	f, err := os.ReadFile(filepath.Join(path, file))
 	if err != nil {
-		return "", fmt.Errorf("error requesting Concourse build status: %w", err)
+		fmt.Fprintf(os.Stderr, "error reading fields_file: %v\nwill be skipped\n", err)
+		return nil
 	}
 
-	return previous.Status, nil
+	var fields []discord.Field
+	if err := yaml.Unmarshal(f, &fields); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing fields_file: %v\nwill be skipped\n", err)
+		return nil
+	}
+	return fields
 }
 
-func previousBuildName(s string) (string, error) {
-	strs := strings.Split(s, ".")
+// mentions returns the content mentioning the roles, users, @everyone and
+// @here of the alert, and the allowed mentions which let only those ping.
+func mentions(alert Alert) (string, *discord.AllowedMentions) {
+	allowed := &discord.AllowedMentions{Parse: []string{}, Roles: alert.Roles, Users: alert.Users}
+
+	var content []string
+	if alert.Everyone {
+		content = append(content, "@everyone")
+	}
+	if alert.Here {
+		content = append(content, "@here")
+	}
+	if alert.Everyone || alert.Here {
+		allowed.Parse = append(allowed.Parse, "everyone")
+	}
+	for _, role := range alert.Roles {
+		content = append(content, fmt.Sprintf("<@&%s>", role))
+	}
+	for _, user := range alert.Users {
+		content = append(content, fmt.Sprintf("<@%s>", user))
+	}
 
-	if len(strs) == 1 {
-		i, err := strconv.Atoi(strs[0])
+	return strings.Join(content, " "), allowed
+}
+
+// readAttachments reads every file matching the glob patterns, relative to
+// the build's sources, as a discord.Attachment. Files matched by more than one
+// pattern are only attached once.
+func readAttachments(path string, patterns []string) []discord.Attachment {
+	var files []discord.Attachment
+	seen := map[string]bool{}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(path, pattern))
 		if err != nil {
-			return "", err
+			fmt.Fprintf(os.Stderr, "error matching attachments %q: %v\nwill be skipped\n", pattern, err)
+			continue
+		}
+		if len(matches) == 0 {
+			fmt.Fprintf(os.Stderr, "no files match attachments %q\n", pattern)
+			continue
 		}
 
-		return strconv.Itoa(i - 1), nil
+		for _, file := range matches {
+			if seen[file] {
+				continue
+			}
+			seen[file] = true
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error reading attachment: %v\nwill be skipped\n", err)
+				continue
+			}
+			files = append(files, discord.Attachment{Filename: filepath.Base(file), Data: data})
+		}
 	}
 
-	i, err := strconv.Atoi(strs[1])
-	if err != nil {
-		return "", err
+	return files
+}
+
+// readMessageID reads the ID of a previously sent message from a file
+// relative to the build's sources, e.g. the message_id file of a get of this
+// resource. An empty ID is returned if the file is not set or cannot be read.
+func readMessageID(path, file string) string {
+	if file == "" {
+		return ""
 	}
 
-	s = fmt.Sprintf("%s.%s", strs[0], strconv.Itoa(i-1))
-	return strings.Trim(s, ".0"), nil
+	f, err := os.ReadFile(filepath.Join(path, file))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading update_message_file: %v\nwill send a new message instead\n", err)
+		return ""
+	}
+	return strings.TrimSpace(string(f))
 }
 
 var maxElapsedTime = 30 * time.Second
 
-func out(input *concourse.OutRequest, path string) (*concourse.OutResponse, error) {
-	if input.Source.URL == "" {
-		return nil, errors.New("discord webhook url cannot be blank")
+// now returns the current time, e.g. of the embed's timestamp.
+var now = time.Now
+
+// requestTimeout is how long a single request to Discord may take.
+const requestTimeout = 10 * time.Second
+
+func out(ctx context.Context, input *concourse.OutRequest, path string) (o *concourse.OutResponse, err error) {
+	// Errors end up in the build log, visible to everyone on the team.
+	defer func() {
+		err = redact(err, input.Source)
+	}()
+
+	targets, err := parseTargets(input.Source)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDelivery(input.Source.Delivery); err != nil {
+		return nil, err
+	}
+	var flakyTargets []target
+	if input.Source.Flaky != nil && len(input.Source.Flaky.URLs) > 0 {
+		flakyTargets, err = parseTargets(concourse.Source{URLs: input.Source.Flaky.URLs})
+		if err != nil {
+			return nil, fmt.Errorf("error parsing flaky urls: %w", err)
+		}
+	}
+	client := &discord.Client{
+		HTTPClient:   &http.Client{Timeout: requestTimeout},
+		MaxRetryTime: maxElapsedTime,
 	}
 
-	alert := NewAlert(input)
+	alert, err := NewAlert(input)
+	if err != nil {
+		return nil, err
+	}
 	metadata := concourse.NewBuildMetadata(input.Source.ConcourseURL)
 	if alert.Disabled {
 		return buildOut(alert.Type, false), nil
 	}
 
+	if alert.DeleteMessage != "" {
+		deliveries := deliver(targets, func(t target) delivery {
+			return deleteMessage(ctx, client, t, alert, targetFile(alert.DeleteMessage, t, targets), path)
+		})
+		if err := checkDeliveries(input.Source.Delivery, deliveries); err != nil {
+			return nil, fmt.Errorf("error deleting discord message: %w", err)
+		}
+		return deliveryOut(buildOut(alert.Type, false), deliveries), nil
+	}
+
+	history := newJobHistory(input, metadata)
 	if alert.Type == "fixed" || alert.Type == "broke" {
-		pstatus, err := previousBuildStatus(input, metadata)
+		pstatus, err := previousBuildStatus(input.Source, history)
 		if err != nil {
 			return nil, fmt.Errorf("error getting last build status: %w", err)
 		}
@@ -158,12 +349,204 @@ func out(input *concourse.OutRequest, path string) (*concourse.OutResponse, erro
 		}
 	}
 
-	message := buildMessage(alert, metadata, path)
-	err := discord.Send(input.Source.URL, message, maxElapsedTime)
+	var current *streak
+	still := alert.Type == "still_failing" || alert.Type == "still_succeeding"
+	if still || alert.AlertOnStreak != nil {
+		s, err := jobStreak(input.Source, history, alert.Type)
+		switch {
+		case err != nil && still:
+			return nil, fmt.Errorf("error getting build streak: %w", err)
+		case err != nil:
+			// Throttling must not hold back alerts, e.g. of failures.
+			fmt.Fprintf(os.Stderr, "error getting build streak: %v\nwill alert as usual instead\n", err)
+		case still && s.Count < 2:
+			return suppressedOut(alert.Type, s.String()), nil
+		case alert.AlertOnStreak != nil && !alert.AlertOnStreak.Alerts(s.Count):
+			return suppressedOut(alert.Type, fmt.Sprintf("%s, alerting on %s", s, alert.AlertOnStreak)), nil
+		default:
+			current = &s
+		}
+	}
+
+	data := newTemplateData(alert.Type, metadata, func() (*concourse.Build, error) {
+		if metadata.ID == "" {
+			return nil, errors.New("BUILD_ID is not set")
+		}
+		c, err := concourse.NewClient(metadata.Host, metadata.TeamName, input.Source.Username, input.Source.Password)
+		if err != nil {
+			return nil, err
+		}
+		return c.Build(metadata.ID)
+	})
+	data.Streak = current
+	if alert.SlowThreshold != 0 {
+		// Without the durations the build cannot be told slow, which must not
+		// fail the put, e.g. of a successful build.
+		build := data.Build()
+		if build.StartTime == 0 {
+			return suppressedOut(alert.Type, "duration unknown, the current build could not be fetched"), nil
+		}
+		builds, err := history()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error getting build duration baseline: %v\nwill not alert instead\n", err)
+			return suppressedOut(alert.Type, "baseline unknown, the builds of the job could not be fetched"), nil
+		}
+		s := jobSlowness(alert, build, builds)
+		if !s.Slow() {
+			reason := s.String()
+			if s.Builds > 0 {
+				reason += fmt.Sprintf(", within %.1fx", s.Threshold)
+			}
+			return suppressedOut(alert.Type, reason), nil
+		}
+		data.Slow = &s
+	}
+	alert.mentionCreatedBy(data)
+	if data.Flaky = detectFlaky(alert, history); data.Flaky != nil {
+		alert.markFlaky()
+		if len(flakyTargets) > 0 {
+			targets = flakyTargets
+		}
+	}
+	messages, err := buildMessages(alert, data, path)
 	if err != nil {
+		return nil, err
+	}
+
+	deliveries := deliver(targets, func(t target) delivery {
+		messageID := ""
+		if alert.UpdateMessageFile != "" {
+			messageID = readMessageID(path, targetFile(alert.UpdateMessageFile, t, targets))
+		}
+		return sendMessages(ctx, client, t, messages, messageID)
+	})
+	if err := checkDeliveries(input.Source.Delivery, deliveries); err != nil {
 		return nil, fmt.Errorf("error sending discord message: %w", err)
 	}
-	return buildOut(alert.Type, true), nil
+
+	o = buildOut(alert.Type, true)
+	if data.Flaky != nil {
+		o.Metadata = append(o.Metadata, concourse.Metadata{Name: "flaky", Value: data.Flaky.String()})
+	}
+	return deliveryOut(o, deliveries), nil
+}
+
+// buildMessages builds the messages of the alert, either from its payload
+// file or by fitting its default message into the limits of Discord.
+func buildMessages(alert Alert, data *templateData, path string) ([]*discord.Message, error) {
+	if alert.PayloadFile != "" {
+		payload, err := buildPayload(alert, data, path)
+		if err != nil {
+			return nil, err
+		}
+		if err := validatePayload(payload); err != nil {
+			return nil, err
+		}
+		return []*discord.Message{payload}, nil
+	}
+
+	message := buildMessage(alert, data, path)
+	messages, err := message.Fit(discord.Overflow(alert.Overflow))
+	if err != nil {
+		return nil, fmt.Errorf("error fitting discord message: %w", err)
+	}
+	for _, m := range messages {
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("discord message exceeds limits: %w", err)
+		}
+	}
+	return messages, nil
+}
+
+// deleteMessage deletes the message given by the delete_message param instead
+// of sending an alert. The message ID is read from file, falling back to the
+// param itself.
+func deleteMessage(ctx context.Context, client *discord.Client, t target, alert Alert, file, path string) delivery {
+	d := delivery{Action: "deleted"}
+	d.MessageID, d.Err = resolveMessageID(path, file)
+	if d.Err != nil && file != alert.DeleteMessage {
+		d.MessageID, d.Err = resolveMessageID(path, alert.DeleteMessage)
+	}
+	if d.Err != nil {
+		return d
+	}
+
+	result, err := client.Delete(ctx, t.Webhook, d.MessageID, alert.ThreadID)
+	if err != nil {
+		d.Err = err
+		return d
+	}
+	d.Results = []*discord.Result{result}
+	return d
+}
+
+// resolveMessageID returns the message ID read from the file s, relative to
+// the build's sources, or s itself if it is a message ID.
+func resolveMessageID(path, s string) (string, error) {
+	f, err := os.ReadFile(filepath.Join(path, s))
+	if err == nil {
+		return strings.TrimSpace(string(f)), nil
+	}
+
+	if _, perr := strconv.ParseUint(s, 10, 64); perr != nil {
+		return "", fmt.Errorf("error reading delete_message: %q is neither a message ID nor a readable file: %w", s, err)
+	}
+	return s, nil
+}
+
+// rateLimitMetadata lists the rate limits of a request, prefixed with the
+// label of its webhook, if set.
+func rateLimitMetadata(label string, result *discord.Result) []concourse.Metadata {
+	var metadata []concourse.Metadata
+	for _, limit := range result.RateLimits {
+		value := limit.String()
+		if label != "" {
+			value = fmt.Sprintf("%s: %s", label, value)
+		}
+		metadata = append(metadata, concourse.Metadata{Name: "rate_limited", Value: value})
+	}
+	return metadata
+}
+
+// redact removes the webhook URLs, their tokens and the Concourse password
+// from err.
+func redact(err error, source concourse.Source) error {
+	secrets := []string{source.Password}
+	urls := []string{source.URL}
+	for _, u := range source.URLs {
+		urls = append(urls, u.URL)
+	}
+	if source.Flaky != nil {
+		for _, u := range source.Flaky.URLs {
+			urls = append(urls, u.URL)
+		}
+	}
+	for _, u := range urls {
+		secrets = append(secrets, u)
+		if webhook, perr := discord.ParseWebhook(u); perr == nil {
+			secrets = append(secrets, webhook.Token)
+		}
+	}
+	return concourse.Redact(err, secrets...)
+}
+
+// explainError describes why Discord rejected a request, listing each
+// invalid field of the payload on its own line. Other errors are returned as
+// is.
+func explainError(err error) error {
+	var apiErr *discord.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	msg := fmt.Sprintf("discord rejected the request with status %d: %s", apiErr.StatusCode, apiErr.Message)
+	if apiErr.Code != 0 {
+		msg = fmt.Sprintf("%s (code %d)", msg, apiErr.Code)
+	}
+	for _, f := range apiErr.Errors {
+		msg += "\n\t- " + f.String()
+	}
+	return errors.New(msg)
 }
 
 func buildOut(atype string, alerted bool) *concourse.OutResponse {
@@ -176,6 +559,14 @@ func buildOut(atype string, alerted bool) *concourse.OutResponse {
 	}
 }
 
+// suppressedOut returns the output of an alert which was not sent, with the
+// reason why.
+func suppressedOut(atype, reason string) *concourse.OutResponse {
+	o := buildOut(atype, false)
+	o.Metadata = append(o.Metadata, concourse.Metadata{Name: "suppressed_reason", Value: reason})
+	return o
+}
+
 func main() {
 	// The first argument is the path to the build's sources
 	path := os.Args[1]
@@ -186,7 +577,11 @@ func main() {
 		log.Fatalln(fmt.Errorf("error reading stdin: %w", err))
 	}
 
-	o, err := out(input, path)
+	// Concourse sends SIGTERM when the step is aborted.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	o, err := out(ctx, input, path)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
@@ -14,13 +19,48 @@ import (
 
 func TestOut(t *testing.T) {
 	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodPost && r.URL.Path != "/api/webhooks/1/s3cr3t/messages/1234" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Unknown Message", "code": 10008}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "1234", "channel_id": "5678", "timestamp": "2026-10-17T12:00:00.000000+00:00"}`))
 	}))
 	defer ok.Close()
 	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 	}))
 	defer bad.Close()
+	limited := 1
+	rateLimited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited > 0 {
+			limited--
+			w.Header().Set("X-RateLimit-Bucket", "abcd1234")
+			w.Header().Set("X-RateLimit-Scope", "shared")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.1, "global": false}`))
+		}
+	}))
+	defer rateLimited.Close()
+	atc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/teams/main/pipelines/demo/jobs/test/builds":
+			w.Write([]byte(`[{"id": 12, "name": "2", "status": "started"}, {"id": 11, "name": "1.1", "status": "aborted"}, {"id": 10, "name": "1", "status": "failed"}]`))
+		case "/api/v1/teams/main/pipelines/demo/jobs/flaky/builds":
+			w.Write([]byte(`[{"id": 35, "name": "5", "status": "started"}, {"id": 34, "name": "4", "status": "failed"}, {"id": 33, "name": "3", "status": "succeeded"}, {"id": 32, "name": "2", "status": "failed"}, {"id": 31, "name": "1", "status": "succeeded"}]`))
+		case "/api/v1/builds/45":
+			w.Write([]byte(`{"id": 45, "name": "4", "status": "started", "start_time": 1792231200, "end_time": 1792232400}`))
+		case "/api/v1/teams/main/pipelines/demo/jobs/slow/builds":
+			w.Write([]byte(`[{"id": 45, "name": "4", "status": "started"}, {"id": 44, "name": "3", "status": "succeeded", "start_time": 1792140000, "end_time": 1792140300}, {"id": 43, "name": "2", "status": "failed", "start_time": 1792130000, "end_time": 1792133600}, {"id": 42, "name": "1", "status": "succeeded", "start_time": 1792120000, "end_time": 1792120600}]`))
+		case "/api/v1/teams/main/pipelines/demo/jobs/stable/builds":
+			w.Write([]byte(`[{"id": 22, "name": "2", "status": "started"}, {"id": 21, "name": "1", "status": "succeeded"}]`))
+		default:
+			http.Error(w, "", http.StatusNotFound)
+		}
+	}))
+	defer atc.Close()
+	webhook := "/api/webhooks/1/s3cr3t"
 
 	env := map[string]string{
 		"ATC_EXTERNAL_URL":    "https://ci.example.com",
@@ -29,131 +69,800 @@ func TestOut(t *testing.T) {
 		"BUILD_JOB_NAME":      "test",
 		"BUILD_NAME":          "2",
 	}
+	history := map[string]string{
+		"ATC_EXTERNAL_URL":    atc.URL,
+		"BUILD_TEAM_NAME":     "main",
+		"BUILD_PIPELINE_NAME": "demo",
+		"BUILD_JOB_NAME":      "test",
+		"BUILD_NAME":          "2",
+	}
+	flaky := map[string]string{
+		"ATC_EXTERNAL_URL":    atc.URL,
+		"BUILD_TEAM_NAME":     "main",
+		"BUILD_PIPELINE_NAME": "demo",
+		"BUILD_JOB_NAME":      "flaky",
+		"BUILD_NAME":          "5",
+	}
+	slow := map[string]string{
+		"ATC_EXTERNAL_URL":    atc.URL,
+		"BUILD_ID":            "45",
+		"BUILD_TEAM_NAME":     "main",
+		"BUILD_PIPELINE_NAME": "demo",
+		"BUILD_JOB_NAME":      "slow",
+		"BUILD_NAME":          "4",
+	}
+	missing := map[string]string{
+		"ATC_EXTERNAL_URL":    atc.URL,
+		"BUILD_TEAM_NAME":     "main",
+		"BUILD_PIPELINE_NAME": "demo",
+		"BUILD_JOB_NAME":      "missing",
+		"BUILD_NAME":          "2",
+	}
+	missingSlow := map[string]string{
+		"ATC_EXTERNAL_URL":    atc.URL,
+		"BUILD_ID":            "45",
+		"BUILD_TEAM_NAME":     "main",
+		"BUILD_PIPELINE_NAME": "demo",
+		"BUILD_JOB_NAME":      "missing",
+		"BUILD_NAME":          "4",
+	}
+	stable := map[string]string{
+		"ATC_EXTERNAL_URL":    atc.URL,
+		"BUILD_TEAM_NAME":     "main",
+		"BUILD_PIPELINE_NAME": "demo",
+		"BUILD_JOB_NAME":      "stable",
+		"BUILD_NAME":          "2",
+	}
 
 	cases := map[string]struct {
 		outRequest *concourse.OutRequest
 		want       *concourse.OutResponse
 		env        map[string]string
+		files      map[string]string
 		err        bool
 	}{
 		"default alert": {
 			outRequest: &concourse.OutRequest{
-				Source: concourse.Source{URL: ok.URL},
+				Source: concourse.Source{URL: ok.URL + webhook},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: env,
+		},
+		"success alert": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "success"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "success"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: env,
+		},
+		"failed alert": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "failed"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "failed"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: env,
+		},
+		"started alert": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "started"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "started"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: env,
+		},
+		"aborted alert": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "aborted"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "aborted"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: env,
+		},
+		"custom alert": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{
+					URL:        ok.URL + webhook,
+					AlertTypes: map[string]concourse.AlertType{"deployed": {Color: "#0000ff"}},
+				},
+				Params: concourse.OutParams{
+					AlertType: "deployed",
+					Message:   "Deploying",
+				},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "deployed"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: env,
+		},
+		"error with unknown alert type": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{
+					AlertType: "non-existent-type",
+					Message:   "Deploying",
+					Color:     "#ffffff",
+				},
+			},
+			env: env,
+			err: true,
+		},
+		"rate limited": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: rateLimited.URL + webhook},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"ver": "static"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "true"},
+					{Name: "rate_limited", Value: "bucket abcd1234 (shared), retry after 100ms"},
+				},
+			},
+			env: env,
+		},
+		"update message": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "success", UpdateMessageFile: "notify/message_id"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "success"},
+					{Name: "alerted", Value: "true"},
+					{Name: "edited", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env:   env,
+			files: map[string]string{"notify/message_id": "1234\n"},
+		},
+		"update unknown message": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "success", UpdateMessageFile: "notify/message_id"},
+			},
+			env:   env,
+			files: map[string]string{"notify/message_id": "4321"},
+			err:   true,
+		},
+		"update message without file": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "success", UpdateMessageFile: "notify/message_id"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "success"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: env,
+		},
+		"delete message": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{DeleteMessage: "1234"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"ver": "static"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "false"},
+					{Name: "deleted", Value: "1234"},
+				},
+			},
+			env: env,
+		},
+		"delete message file": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{DeleteMessage: "notify/message_id"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"ver": "static"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "false"},
+					{Name: "deleted", Value: "1234"},
+				},
+			},
+			env:   env,
+			files: map[string]string{"notify/message_id": "1234"},
+		},
+		"error deleting missing message file": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{DeleteMessage: "notify/message_id"},
+			},
+			env: env,
+			err: true,
+		},
+		"error deleting unknown message": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{DeleteMessage: "4321"},
+			},
+			env: env,
+			err: true,
+		},
+		"split long text": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "failed", TextFile: "output.txt", Overflow: "split"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "failed"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+					{Name: "messages", Value: "2"},
+				},
+			},
+			env:   env,
+			files: map[string]string{"output.txt": strings.Repeat("word ", 2000)},
+		},
+		"truncate long text": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "failed", TextFile: "output.txt"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "failed"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env:   env,
+			files: map[string]string{"output.txt": strings.Repeat("word ", 2000)},
+		},
+		"error with unknown overflow": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{Overflow: "drop"},
+			},
+			env: env,
+			err: true,
+		},
+		"disable alert": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: bad.URL + webhook},
+				Params: concourse.OutParams{Disable: true},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"ver": "static"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "false"},
+				},
+			},
+			env: env,
+		},
+		"error without Discord URL": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ""},
+			},
+			env: env,
+			err: true,
+		},
+		"proxy URL": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + "/s3cr3t"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: env,
+		},
+		"error with invalid Discord URL": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: "https://discord.com/api/s3cr3t"},
+			},
+			env: env,
+			err: true,
+		},
+		"error with bad request": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: bad.URL + webhook},
+			},
+			env: env,
+			err: true,
+		},
+		"multiple webhooks": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{
+					URL:  ok.URL + webhook,
+					URLs: []concourse.WebhookURL{{URL: ok.URL + webhook, Label: "ops"}},
+				},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{
+					"message_id.1":   "1234",
+					"channel_id.1":   "5678",
+					"message_id.ops": "1234",
+					"channel_id.ops": "5678",
+				},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "true"},
+					{Name: "delivery.1", Value: "sent 1234"},
+					{Name: "delivery.ops", Value: "sent 1234"},
+				},
+			},
+			env: env,
+		},
+		"multiple webhooks with a failure": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{
+					URLs: []concourse.WebhookURL{
+						{URL: ok.URL + webhook, Label: "eng"},
+						{URL: bad.URL + webhook, Label: "ops"},
+					},
+				},
+			},
+			env: env,
+			err: true,
+		},
+		"multiple webhooks with a failure delivering to any": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{
+					URLs: []concourse.WebhookURL{
+						{URL: ok.URL + webhook, Label: "eng"},
+						{URL: bad.URL + webhook, Label: "ops"},
+					},
+					Delivery: "any",
+				},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id.eng": "1234", "channel_id.eng": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "true"},
+					{Name: "delivery.eng", Value: "sent 1234"},
+					{Name: "delivery.ops", Value: "failed: discord rejected the request with status 404: Not Found"},
+				},
+			},
+			env: env,
+		},
+		"multiple webhooks failing delivering to any": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{
+					URLs:     []concourse.WebhookURL{{URL: bad.URL + webhook, Label: "eng"}, {URL: bad.URL + webhook, Label: "ops"}},
+					Delivery: "any",
+				},
+			},
+			env: env,
+			err: true,
+		},
+		"multiple webhooks updating messages": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{
+					URLs: []concourse.WebhookURL{{URL: ok.URL + webhook, Label: "eng"}, {URL: ok.URL + webhook, Label: "ops"}},
+				},
+				Params: concourse.OutParams{UpdateMessageFile: "notify/message_id"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{
+					"message_id.eng": "1234",
+					"channel_id.eng": "5678",
+					"message_id.ops": "1234",
+					"channel_id.ops": "5678",
+				},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "true"},
+					{Name: "delivery.eng", Value: "edited 1234"},
+					{Name: "delivery.ops", Value: "sent 1234"},
+				},
+			},
+			env:   env,
+			files: map[string]string{"notify/message_id.eng": "1234"},
+		},
+		"multiple webhooks deleting messages": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{
+					URLs: []concourse.WebhookURL{{URL: ok.URL + webhook, Label: "eng"}, {URL: ok.URL + webhook, Label: "ops"}},
+				},
+				Params: concourse.OutParams{DeleteMessage: "notify/message_id"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"ver": "static"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "false"},
+					{Name: "delivery.eng", Value: "deleted 1234"},
+					{Name: "delivery.ops", Value: "deleted 1234"},
+				},
+			},
+			env:   env,
+			files: map[string]string{"notify/message_id.eng": "1234", "notify/message_id.ops": "1234"},
+		},
+		"payload file": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{PayloadFile: "payload.yml"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "default"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env:   env,
+			files: map[string]string{"payload.yml": "embeds:\n  - title: '{{ .PipelineName }} deployed'\n"},
+		},
+		"error with payload file exceeding limits": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{PayloadFile: "payload.yml"},
+			},
+			env:   env,
+			files: map[string]string{"payload.yml": "content: " + strings.Repeat("a", discord.MaxContentLength+1)},
+			err:   true,
+		},
+		"error with missing payload file": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{PayloadFile: "payload.yml"},
+			},
+			env: env,
+			err: true,
+		},
+		"error with duplicate webhook labels": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{
+					URL:  ok.URL + webhook,
+					URLs: []concourse.WebhookURL{{URL: ok.URL + webhook}},
+				},
+			},
+			env: env,
+			err: true,
+		},
+		"error with unknown delivery": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook, Delivery: "some"},
+			},
+			env: env,
+			err: true,
+		},
+		"fixed after failure": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "fixed"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "fixed"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: history,
+		},
+		"fixed after success": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "fixed"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"ver": "static"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "fixed"},
+					{Name: "alerted", Value: "false"},
+				},
+			},
+			env: stable,
+		},
+		"broke after success": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "broke"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "broke"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: stable,
+		},
+		"broke after aborted rerun of failure": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "broke"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"ver": "static"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "broke"},
+					{Name: "alerted", Value: "false"},
+				},
+			},
+			env: history,
+		},
+		"still failing after aborted rerun": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "still_failing"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "still_failing"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: history,
+		},
+		"still failing below threshold": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "still_failing", AlertOnStreak: &concourse.StreakPolicy{At: []int{3, 5}}},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"ver": "static"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "still_failing"},
+					{Name: "alerted", Value: "false"},
+					{Name: "suppressed_reason", Value: "failing for 2 builds since build #1, alerting on 3, 5"},
+				},
+			},
+			env: history,
+		},
+		"failed suppressed on streak": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "failed", AlertOnStreak: &concourse.StreakPolicy{At: []int{1, 5}, Every: 10}},
 			},
 			want: &concourse.OutResponse{
 				Version: concourse.Version{"ver": "static"},
 				Metadata: []concourse.Metadata{
-					{Name: "type", Value: "default"},
-					{Name: "alerted", Value: "true"},
+					{Name: "type", Value: "failed"},
+					{Name: "alerted", Value: "false"},
+					{Name: "suppressed_reason", Value: "failing for 2 builds since build #1, alerting on 1, 5, then every 10th"},
 				},
 			},
-			env: env,
+			env: history,
 		},
-		"success alert": {
+		"failed alerted on streak": {
 			outRequest: &concourse.OutRequest{
-				Source: concourse.Source{URL: ok.URL},
-				Params: concourse.OutParams{AlertType: "success"},
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "failed", AlertOnStreak: &concourse.StreakPolicy{At: []int{1, 2}}},
 			},
 			want: &concourse.OutResponse{
-				Version: concourse.Version{"ver": "static"},
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
 				Metadata: []concourse.Metadata{
-					{Name: "type", Value: "success"},
+					{Name: "type", Value: "failed"},
 					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
 				},
 			},
-			env: env,
+			env: history,
 		},
-		"failed alert": {
+		"failed on streak without history": {
 			outRequest: &concourse.OutRequest{
-				Source: concourse.Source{URL: ok.URL},
-				Params: concourse.OutParams{AlertType: "failed"},
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "failed", AlertOnStreak: &concourse.StreakPolicy{Every: 10}},
 			},
 			want: &concourse.OutResponse{
-				Version: concourse.Version{"ver": "static"},
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
 				Metadata: []concourse.Metadata{
 					{Name: "type", Value: "failed"},
 					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
 				},
 			},
-			env: env,
+			env: missing,
 		},
-		"started alert": {
+		"error with still failing without history": {
 			outRequest: &concourse.OutRequest{
-				Source: concourse.Source{URL: ok.URL},
-				Params: concourse.OutParams{AlertType: "started"},
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "still_failing"},
+			},
+			env: missing,
+			err: true,
+		},
+		"still succeeding after success": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "still_succeeding"},
 			},
 			want: &concourse.OutResponse{
-				Version: concourse.Version{"ver": "static"},
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
 				Metadata: []concourse.Metadata{
-					{Name: "type", Value: "started"},
+					{Name: "type", Value: "still_succeeding"},
 					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
 				},
 			},
-			env: env,
+			env: stable,
 		},
-		"aborted alert": {
+		"still succeeding after failure": {
 			outRequest: &concourse.OutRequest{
-				Source: concourse.Source{URL: ok.URL},
-				Params: concourse.OutParams{AlertType: "aborted"},
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "still_succeeding"},
 			},
 			want: &concourse.OutResponse{
 				Version: concourse.Version{"ver": "static"},
 				Metadata: []concourse.Metadata{
-					{Name: "type", Value: "aborted"},
+					{Name: "type", Value: "still_succeeding"},
+					{Name: "alerted", Value: "false"},
+					{Name: "suppressed_reason", Value: "succeeding for 1 build"},
+				},
+			},
+			env: history,
+		},
+		"flaky failure": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{
+					URL:   bad.URL + webhook,
+					Flaky: &concourse.FlakyPolicy{Builds: 4, URLs: []concourse.WebhookURL{{URL: ok.URL + webhook}}},
+				},
+				Params: concourse.OutParams{AlertType: "failed", Role: "1"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "failed"},
+					{Name: "alerted", Value: "true"},
+					{Name: "flaky", Value: "result changed 3 times in the last 4 builds"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
+				},
+			},
+			env: flaky,
+		},
+		"flaky job not flaky enough": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook, Flaky: &concourse.FlakyPolicy{Builds: 4, Ratio: 1.0, URLs: []concourse.WebhookURL{{URL: bad.URL + webhook}}}},
+				Params: concourse.OutParams{AlertType: "failed"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "failed"},
 					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
 				},
 			},
+			env: history,
+		},
+		"error with invalid flaky urls": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook, Flaky: &concourse.FlakyPolicy{URLs: []concourse.WebhookURL{{URL: "https://discord.com/api/s3cr3t"}}}},
+				Params: concourse.OutParams{AlertType: "failed"},
+			},
 			env: env,
+			err: true,
 		},
-		"custom alert": {
+		"duration regressed": {
 			outRequest: &concourse.OutRequest{
-				Source: concourse.Source{URL: ok.URL},
-				Params: concourse.OutParams{
-					AlertType: "non-existent-type",
-					Message:   "Deploying",
-					Color:     "#ffffff",
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "duration"},
+			},
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"message_id": "1234", "channel_id": "5678"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "duration"},
+					{Name: "alerted", Value: "true"},
+					{Name: "timestamp", Value: "2026-10-17T12:00:00.000000+00:00"},
 				},
 			},
+			env: slow,
+		},
+		"success within slow threshold": {
+			outRequest: &concourse.OutRequest{
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "success", SlowThreshold: 5, SlowBaseline: "p50"},
+			},
 			want: &concourse.OutResponse{
 				Version: concourse.Version{"ver": "static"},
 				Metadata: []concourse.Metadata{
-					{Name: "type", Value: "default"},
-					{Name: "alerted", Value: "true"},
+					{Name: "type", Value: "success"},
+					{Name: "alerted", Value: "false"},
+					{Name: "suppressed_reason", Value: "took 20m0s, 4.0x the p50 of 5m0s (p90 10m0s) of the last 2 successful builds, within 5.0x"},
 				},
 			},
-			env: env,
+			env: slow,
 		},
-		"disable alert": {
+		"success with slow threshold without build": {
 			outRequest: &concourse.OutRequest{
-				Source: concourse.Source{URL: bad.URL},
-				Params: concourse.OutParams{Disable: true},
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "success", SlowThreshold: 2},
 			},
 			want: &concourse.OutResponse{
 				Version: concourse.Version{"ver": "static"},
 				Metadata: []concourse.Metadata{
-					{Name: "type", Value: "default"},
+					{Name: "type", Value: "success"},
 					{Name: "alerted", Value: "false"},
+					{Name: "suppressed_reason", Value: "duration unknown, the current build could not be fetched"},
 				},
 			},
-			env: env,
+			env: history,
 		},
-		"error without Discord URL": {
+		"duration without history": {
 			outRequest: &concourse.OutRequest{
-				Source: concourse.Source{URL: ""},
+				Source: concourse.Source{URL: ok.URL + webhook},
+				Params: concourse.OutParams{AlertType: "duration"},
 			},
-			env: env,
-			err: true,
+			want: &concourse.OutResponse{
+				Version: concourse.Version{"ver": "static"},
+				Metadata: []concourse.Metadata{
+					{Name: "type", Value: "duration"},
+					{Name: "alerted", Value: "false"},
+					{Name: "suppressed_reason", Value: "baseline unknown, the builds of the job could not be fetched"},
+				},
+			},
+			env: missingSlow,
 		},
-		"error with bad request": {
+		"error with unknown skip status": {
 			outRequest: &concourse.OutRequest{
-				Source: concourse.Source{URL: bad.URL},
+				Source: concourse.Source{URL: ok.URL + webhook, SkipStatuses: []string{"pending"}},
+				Params: concourse.OutParams{AlertType: "fixed"},
 			},
-			env: env,
+			env: history,
 			err: true,
 		},
 		"error without basic auth for fixed type": {
 			outRequest: &concourse.OutRequest{
-				Source: concourse.Source{URL: ok.URL, Username: "", Password: ""},
+				Source: concourse.Source{URL: ok.URL + webhook, Username: "", Password: ""},
 				Params: concourse.OutParams{AlertType: "fixed"},
 			},
 			env: env,
@@ -164,11 +873,24 @@ func TestOut(t *testing.T) {
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			for k, v := range c.env {
-				os.Setenv(k, v)
+				t.Setenv(k, v)
+			}
+
+			path := t.TempDir()
+			for name, contents := range c.files {
+				file := filepath.Join(path, name)
+				if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(file, []byte(contents), 0666); err != nil {
+					t.Fatal(err)
+				}
 			}
 
-			got, err := out(c.outRequest, "")
-			if err != nil && !c.err {
+			got, err := out(context.Background(), c.outRequest, path)
+			if err != nil && strings.Contains(err.Error(), "s3cr3t") {
+				t.Fatalf("unexpected secret in error from out:\n\t(ERR): %s", err)
+			} else if err != nil && !c.err {
 				t.Fatalf("unexpected error from out:\n\t(ERR): %s", err)
 			} else if err == nil && c.err {
 				t.Fatalf("expected an error from out:\n\t(GOT): nil")
@@ -179,10 +901,26 @@ func TestOut(t *testing.T) {
 	}
 }
 
+func TestOutCanceled(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", http.StatusBadGateway)
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := out(ctx, &concourse.OutRequest{Source: concourse.Source{URL: s.URL + "/api/webhooks/1/s3cr3t"}}, t.TempDir())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error from out:\n\t(GOT): %v\n\t(WNT): %v", err, context.Canceled)
+	}
+}
+
 func TestBuildMessage(t *testing.T) {
 	cases := map[string]struct {
-		alert Alert
-		want  *discord.Message
+		alert     Alert
+		createdBy string
+		want      *discord.Message
 	}{
 		"url set": {
 			alert: Alert{
@@ -191,12 +929,13 @@ func TestBuildMessage(t *testing.T) {
 				IconURL: "",
 				Message: "Testing",
 			},
-			want: &discord.Message{Username: "Concourse", AvatarURL: "", Embeds: []discord.Embed{
+			want: &discord.Message{Username: "Concourse", AvatarURL: "", AllowedMentions: &discord.AllowedMentions{Parse: []string{}}, Embeds: []discord.Embed{
 				{
 					Title:       "Testing",
 					Description: "The execution of task `test` in pipeline `demo` ended with status `default`.",
 					Color:       16777215,
 					URL:         "https://ci.example.com/teams/main/pipelines/demo/jobs/test/builds/1",
+					Timestamp:   "2026-10-17T12:00:00Z",
 					Fields: []discord.Field{
 						{
 							Name:   "Step",
@@ -218,14 +957,175 @@ func TestBuildMessage(t *testing.T) {
 				Color:   "#ffffff",
 				IconURL: "",
 				Message: "Testing",
-				Role:    "1234567890",
+				Roles:   []string{"1234567890"},
+			},
+			want: &discord.Message{Username: "Concourse", AvatarURL: "", Content: "<@&1234567890>", AllowedMentions: &discord.AllowedMentions{Parse: []string{}, Roles: []string{"1234567890"}}, Embeds: []discord.Embed{
+				{
+					Title:       "Testing",
+					Description: "The execution of task `test` in pipeline `demo` ended with status `default`.",
+					Color:       16777215,
+					URL:         "https://ci.example.com/teams/main/pipelines/demo/jobs/test/builds/1",
+					Timestamp:   "2026-10-17T12:00:00Z",
+					Fields: []discord.Field{
+						{
+							Name:   "Step",
+							Value:  "`demo/test`",
+							Inline: true,
+						},
+						{
+							Name:   "Build",
+							Value:  "`1`",
+							Inline: true,
+						},
+					},
+				},
+			}},
+		},
+		"mentions": {
+			alert: Alert{
+				Type:     "default",
+				Color:    "#ffffff",
+				Message:  "@everyone <@&1> <@2> ",
+				Text:     "@here",
+				Roles:    []string{"3", "4"},
+				Users:    []string{"5"},
+				Everyone: true,
+				Here:     true,
+			},
+			want: &discord.Message{
+				Username:        "Concourse",
+				AvatarURL:       "",
+				Content:         "@everyone @here <@&3> <@&4> <@5>",
+				AllowedMentions: &discord.AllowedMentions{Parse: []string{"everyone"}, Roles: []string{"3", "4"}, Users: []string{"5"}},
+				Embeds: []discord.Embed{
+					{
+						Title:       "@\u200beveryone <@\u200b&1> <@\u200b2> @\u200bhere",
+						Description: "The execution of task `test` in pipeline `demo` ended with status `default`.",
+						Color:       16777215,
+						URL:         "https://ci.example.com/teams/main/pipelines/demo/jobs/test/builds/1",
+						Timestamp:   "2026-10-17T12:00:00Z",
+						Fields: []discord.Field{
+							{
+								Name:   "Step",
+								Value:  "`demo/test`",
+								Inline: true,
+							},
+							{
+								Name:   "Build",
+								Value:  "`1`",
+								Inline: true,
+							},
+						},
+					},
+				},
+			},
+		},
+		"templates": {
+			alert: Alert{
+				Type:        "failed",
+				Color:       "#ffffff",
+				Message:     "{{ .Type | upper }}",
+				Text:        " {{ .Metadata.PipelineName }}",
+				Description: "Build {{ .Metadata.BuildName }} of `{{ .Metadata.JobName }}` {{ if eq .Type \"failed\" }}failed{{ end }}",
+			},
+			want: &discord.Message{Username: "Concourse", AvatarURL: "", AllowedMentions: &discord.AllowedMentions{Parse: []string{}}, Embeds: []discord.Embed{
+				{
+					Title:       "FAILED demo",
+					Description: "Build 1 of `test` failed",
+					Color:       16777215,
+					URL:         "https://ci.example.com/teams/main/pipelines/demo/jobs/test/builds/1",
+					Timestamp:   "2026-10-17T12:00:00Z",
+					Fields: []discord.Field{
+						{
+							Name:   "Step",
+							Value:  "`demo/test`",
+							Inline: true,
+						},
+						{
+							Name:   "Build",
+							Value:  "`1`",
+							Inline: true,
+						},
+					},
+				},
+			}},
+		},
+		"username and avatar": {
+			alert: Alert{
+				Type:      "default",
+				Color:     "#ffffff",
+				IconURL:   "https://example.com/icon.png",
+				Message:   "Testing",
+				Username:  "CI • {{ .PipelineName }}",
+				AvatarURL: "https://example.com/{{ .JobName }}.png",
+			},
+			want: &discord.Message{Username: "CI • demo", AvatarURL: "https://example.com/test.png", AllowedMentions: &discord.AllowedMentions{Parse: []string{}}, Embeds: []discord.Embed{
+				{
+					Title:       "Testing",
+					Description: "The execution of task `test` in pipeline `demo` ended with status `default`.",
+					Color:       16777215,
+					URL:         "https://ci.example.com/teams/main/pipelines/demo/jobs/test/builds/1",
+					Timestamp:   "2026-10-17T12:00:00Z",
+					Fields: []discord.Field{
+						{
+							Name:   "Step",
+							Value:  "`demo/test`",
+							Inline: true,
+						},
+						{
+							Name:   "Build",
+							Value:  "`1`",
+							Inline: true,
+						},
+					},
+				},
+			}},
+		},
+		"created by": {
+			alert: Alert{
+				Type:    "default",
+				Color:   "#ffffff",
+				Message: "Testing",
+			},
+			createdBy: "alice",
+			want: &discord.Message{Username: "Concourse", AvatarURL: "", AllowedMentions: &discord.AllowedMentions{Parse: []string{}}, Embeds: []discord.Embed{
+				{
+					Title:       "Testing",
+					Description: "The execution of task `test` in pipeline `demo` ended with status `default`.",
+					Color:       16777215,
+					URL:         "https://ci.example.com/teams/main/pipelines/demo/jobs/test/builds/1",
+					Timestamp:   "2026-10-17T12:00:00Z",
+					Author:      &discord.Author{Name: "Triggered by alice"},
+					Fields: []discord.Field{
+						{
+							Name:   "Step",
+							Value:  "`demo/test`",
+							Inline: true,
+						},
+						{
+							Name:   "Build",
+							Value:  "`1`",
+							Inline: true,
+						},
+					},
+				},
+			}},
+		},
+		"forum post": {
+			alert: Alert{
+				Type:        "default",
+				Color:       "#ffffff",
+				Message:     "Testing",
+				ThreadName:  "{{ .PipelineName }}/{{ .JobName }}",
+				AppliedTags: []string{"1234"},
 			},
-			want: &discord.Message{Username: "Concourse", AvatarURL: "", Content: "<@&1234567890>", Embeds: []discord.Embed{
+			want: &discord.Message{Username: "Concourse", AvatarURL: "", AllowedMentions: &discord.AllowedMentions{Parse: []string{}}, ThreadName: "demo/test", AppliedTags: []string{"1234"}, Embeds: []discord.Embed{
 				{
 					Title:       "Testing",
 					Description: "The execution of task `test` in pipeline `demo` ended with status `default`.",
 					Color:       16777215,
 					URL:         "https://ci.example.com/teams/main/pipelines/demo/jobs/test/builds/1",
+					Timestamp:   "2026-10-17T12:00:00Z",
 					Fields: []discord.Field{
 						{
 							Name:   "Step",
@@ -247,12 +1147,13 @@ func TestBuildMessage(t *testing.T) {
 				Message:     "Testing",
 				MessageFile: "test_file",
 			},
-			want: &discord.Message{Username: "Concourse", AvatarURL: "", Embeds: []discord.Embed{
+			want: &discord.Message{Username: "Concourse", AvatarURL: "", AllowedMentions: &discord.AllowedMentions{Parse: []string{}}, Embeds: []discord.Embed{
 				{
 					Title:       "filecontents",
 					Description: "The execution of task `test` in pipeline `demo` ended with status `default`.",
 					Color:       3492188,
 					URL:         "https://ci.example.com/teams/main/pipelines/demo/jobs/test/builds/1",
+					Timestamp:   "2026-10-17T12:00:00Z",
 					Fields: []discord.Field{
 						{
 							Name:   "Step",
@@ -274,12 +1175,13 @@ func TestBuildMessage(t *testing.T) {
 				Message:     "Testing",
 				MessageFile: "missing file",
 			},
-			want: &discord.Message{Username: "Concourse", AvatarURL: "", Embeds: []discord.Embed{
+			want: &discord.Message{Username: "Concourse", AvatarURL: "", AllowedMentions: &discord.AllowedMentions{Parse: []string{}}, Embeds: []discord.Embed{
 				{
 					Title:       "Testing",
 					Description: "The execution of task `test` in pipeline `demo` ended with status `default`.",
 					Color:       3492188,
 					URL:         "https://ci.example.com/teams/main/pipelines/demo/jobs/test/builds/1",
+					Timestamp:   "2026-10-17T12:00:00Z",
 					Fields: []discord.Field{
 						{
 							Name:   "Step",
@@ -305,6 +1207,9 @@ func TestBuildMessage(t *testing.T) {
 		URL:          "https://ci.example.com/teams/main/pipelines/demo/jobs/test/builds/1",
 	}
 
+	now = func() time.Time { return time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
 			path := ""
@@ -316,7 +1221,9 @@ func TestBuildMessage(t *testing.T) {
 				}
 			}
 
-			got := buildMessage(c.alert, metadata, path)
+			m := metadata
+			m.CreatedBy = c.createdBy
+			got := buildMessage(c.alert, newTemplateData(c.alert.Type, m, nil), path)
 			if !cmp.Equal(got, c.want) {
 				t.Fatalf("unexpected discord.Message value from buildDiscordMessage:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
 			}
@@ -324,48 +1231,200 @@ func TestBuildMessage(t *testing.T) {
 	}
 }
 
-func TestPreviousBuildName(t *testing.T) {
+func TestReadAttachments(t *testing.T) {
+	path := t.TempDir()
+	for _, name := range []string{"report.xml", "unit.log", "lint.log"} {
+		if err := os.WriteFile(filepath.Join(path, name), []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
 	cases := map[string]struct {
-		build string
-		want  string
+		patterns []string
+		want     []discord.Attachment
+	}{
+		"none": {},
+		"file": {
+			patterns: []string{"report.xml"},
+			want:     []discord.Attachment{{Filename: "report.xml", Data: []byte("report.xml")}},
+		},
+		"glob": {
+			patterns: []string{"*.log"},
+			want: []discord.Attachment{
+				{Filename: "lint.log", Data: []byte("lint.log")},
+				{Filename: "unit.log", Data: []byte("unit.log")},
+			},
+		},
+		"duplicate matches": {
+			patterns: []string{"unit.log", "*.log"},
+			want: []discord.Attachment{
+				{Filename: "unit.log", Data: []byte("unit.log")},
+				{Filename: "lint.log", Data: []byte("lint.log")},
+			},
+		},
+		"missing file": {
+			patterns: []string{"missing.txt"},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := readAttachments(path, c.patterns)
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected attachments from readAttachments:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			}
+		})
+	}
+}
+
+func TestBuildFields(t *testing.T) {
+	path := t.TempDir()
+	files := map[string]string{
+		"fields.json": `[{"name": "Version", "value": "1.2.3", "inline": true}]`,
+		"fields.yml":  "- name: Tests\n  value: '120 passed, 2 failed'\n- name: Ping\n  value: '@everyone {{ .Type }}'\n",
+		"invalid.yml": "name: Tests",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(path, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
 
-		err bool
+	defaults := []discord.Field{
+		{Name: "Step", Value: "`demo/test`", Inline: true},
+		{Name: "Build", Value: "`1`", Inline: true},
+	}
+
+	cases := map[string]struct {
+		alert  Alert
+		build  *concourse.Build
+		streak *streak
+		want   []discord.Field
 	}{
-		"standard": {
-			build: "6",
-			want:  "6",
+		"defaults": {
+			want: defaults,
 		},
-		"rerun 1": {
-			build: "6.1",
-			want:  "6",
+		"params": {
+			alert: Alert{Type: "success", Fields: []concourse.Field{
+				{Name: "Environment", Value: "production", Inline: true},
+				{Name: "Result", Value: "{{ .Type }}"},
+			}},
+			want: append(defaults,
+				discord.Field{Name: "Environment", Value: "production", Inline: true},
+				discord.Field{Name: "Result", Value: "success"},
+			),
 		},
-		"rerun x": {
-			build: "6.2",
-			want:  "6.1",
+		"json file": {
+			alert: Alert{FieldsFile: "fields.json"},
+			want:  append(defaults, discord.Field{Name: "Version", Value: "1.2.3", Inline: true}),
 		},
-		"error 1": {
-			build: "X",
-			err:   true,
+		"yaml file": {
+			alert: Alert{FieldsFile: "fields.yml"},
+			want: append(defaults,
+				discord.Field{Name: "Tests", Value: "120 passed, 2 failed"},
+				discord.Field{Name: "Ping", Value: "@\u200beveryone {{ .Type }}"},
+			),
 		},
-		"error x": {
-			build: "6.X",
-			err:   true,
+		"replace": {
+			alert: Alert{
+				ReplaceFields: true,
+				Fields:        []concourse.Field{{Name: "Environment", Value: "staging"}},
+				FieldsFile:    "fields.json",
+			},
+			want: []discord.Field{
+				{Name: "Environment", Value: "staging"},
+				{Name: "Version", Value: "1.2.3", Inline: true},
+			},
+		},
+		"empty value": {
+			alert: Alert{Fields: []concourse.Field{{Name: "Empty", Value: "{{ .Env.FIELDS_TEST_MISSING }}"}}},
+			want:  defaults,
+		},
+		"missing file": {
+			alert: Alert{FieldsFile: "missing.yml"},
+			want:  defaults,
+		},
+		"build": {
+			build: &concourse.Build{StartTime: 1792231200, EndTime: 1792231200 + 95},
+			want: append(defaults,
+				discord.Field{Name: "Duration", Value: "`1m35s`", Inline: true},
+				discord.Field{Name: "Started", Value: "<t:1792231200:R>", Inline: true},
+				discord.Field{Name: "Ended", Value: "<t:1792231295:R>", Inline: true},
+			),
+		},
+		"running build": {
+			build: &concourse.Build{StartTime: 1792231200},
+			alert: Alert{Fields: []concourse.Field{{Name: "Status", Value: "{{ .Build.Status }}"}}},
+			want: append(defaults,
+				discord.Field{Name: "Duration", Value: "`1m0s`", Inline: true},
+				discord.Field{Name: "Started", Value: "<t:1792231200:R>", Inline: true},
+			),
+		},
+		"replaced build": {
+			build: &concourse.Build{StartTime: 1792231200, EndTime: 1792231200 + 95},
+			alert: Alert{ReplaceFields: true, Fields: []concourse.Field{{Name: "Took", Value: "{{ .Duration | duration }}"}}},
+			want:  []discord.Field{{Name: "Took", Value: "1m35s"}},
+		},
+		"invalid file": {
+			alert: Alert{FieldsFile: "invalid.yml"},
+			want:  defaults,
+		},
+		"streak": {
+			alert:  Alert{Type: "still_failing"},
+			streak: &streak{Status: "failed", Count: 3, Since: &concourse.Build{Name: "7"}},
+			want:   append(defaults, discord.Field{Name: "Streak", Value: "failing for 3 builds since build #7"}),
 		},
 	}
 
+	now = func() time.Time { return time.Unix(1792231200+60, 0) }
+	defer func() { now = time.Now }()
+
+	metadata := concourse.BuildMetadata{PipelineName: "demo", JobName: "test", BuildName: "1"}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
-			got, err := previousBuildName(c.build)
-			if err != nil && !c.err {
-				t.Fatalf("unexpected error from previousBuildName:\n\t(ERR): %s", err)
-			} else if err == nil && c.err {
-				t.Fatalf("expected an error from previousBuildName:\n\t(GOT): nil")
-			} else if err != nil && c.err {
-				return
+			fetch := func() (*concourse.Build, error) { return nil, errors.New("unreachable") }
+			if c.build != nil {
+				fetch = func() (*concourse.Build, error) { return c.build, nil }
+			}
+			data := newTemplateData(c.alert.Type, metadata, fetch)
+			data.Streak = c.streak
+			got := buildFields(c.alert, data, path)
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected fields from buildFields:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
 			}
+		})
+	}
+}
+
+func TestExplainError(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		want string
+	}{
+		"other error": {
+			err:  errors.New("connection refused"),
+			want: "connection refused",
+		},
+		"unknown webhook": {
+			err:  &discord.APIError{StatusCode: 404, Code: 10015, Message: "Unknown Webhook"},
+			want: "discord rejected the request with status 404: Unknown Webhook (code 10015)",
+		},
+		"invalid fields": {
+			err: fmt.Errorf("wrapped: %w", &discord.APIError{StatusCode: 400, Code: 50035, Message: "Invalid Form Body", Errors: []discord.FieldError{
+				{Path: "embeds[0].fields[1].value", Code: "BASE_TYPE_MAX_LENGTH", Message: "Must be 1024 or fewer in length."},
+				{Path: "embeds[0].title", Code: "BASE_TYPE_MAX_LENGTH", Message: "Must be 256 or fewer in length."},
+			}}),
+			want: "discord rejected the request with status 400: Invalid Form Body (code 50035)\n" +
+				"\t- embeds[0].fields[1].value must be 1024 or fewer in length\n" +
+				"\t- embeds[0].title must be 256 or fewer in length",
+		},
+	}
 
-			if err != nil {
-				t.Fatalf("unexpected value from previousBuildName:\n\t(GOT): %#v\n\t(WNT): %#v", got, c.want)
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := explainError(c.err).Error()
+			if got != c.want {
+				t.Fatalf("unexpected value from explainError:\n\t(GOT): %s\n\t(WNT): %s", got, c.want)
 			}
 		})
 	}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tklein1801/concourse-discord-alert-resource/discord"
+	"sigs.k8s.io/yaml"
+)
+
+// buildPayload builds the Discord message of the alert from the JSON or YAML
+// message of the payload file, relative to the build's sources. Its texts are
+// rendered as templates with data and it is completed with the defaults of
+// the alert: username and avatar, mentions, attachments and thread. The icon
+// of the alert is only used as the avatar if icons are linked.
+// An error is returned if the payload file cannot be read or parsed.
+func buildPayload(alert Alert, data *templateData, path string) (*discord.Message, error) {
+	m := data.BuildMetadata
+	f, err := os.ReadFile(filepath.Join(path, alert.PayloadFile))
+	if err != nil {
+		return nil, fmt.Errorf("error reading payload_file: %w", err)
+	}
+
+	var msg *discord.Message
+	if err := yaml.Unmarshal(f, &msg); err != nil {
+		return nil, fmt.Errorf("error parsing payload_file: %w", err)
+	}
+	if msg == nil {
+		return nil, errors.New("error parsing payload_file: file is empty")
+	}
+
+	// Values are rendered after parsing, since metadata such as the instance
+	// vars would break the JSON or YAML.
+	renderMessage(msg, data)
+
+	if msg.Username == "" {
+		msg.Username = render("username", alert.username(), data)
+	}
+	if msg.AvatarURL == "" {
+		msg.AvatarURL = render("avatar_url", alert.AvatarURL, data)
+	}
+	// Icons uploaded with the alert cannot be avatars, and the payload is sent
+	// as is, so the icon is only used if it is linked.
+	if iconURL, iconFile := alert.icon(m.Host); msg.AvatarURL == "" && iconFile == nil {
+		msg.AvatarURL = iconURL
+	}
+
+	// Only the configured mentions may ping, regardless of the payload.
+	content, allowed := mentions(alert)
+	msg.Content = strings.TrimSpace(content + "\n" + msg.Content)
+	msg.AllowedMentions = allowed
+
+	msg.Files = readAttachments(path, alert.Attachments)
+
+	msg.ThreadID = alert.ThreadID
+	if msg.ThreadName == "" {
+		msg.ThreadName = render("thread_name", alert.ThreadName, data)
+	}
+	if len(msg.AppliedTags) == 0 {
+		msg.AppliedTags = alert.AppliedTags
+	}
+	return msg, nil
+}
+
+// renderMessage renders every text and URL of the message as a template with
+// data.
+func renderMessage(msg *discord.Message, data *templateData) {
+	r := func(text string) string {
+		return render("payload_file", text, data)
+	}
+
+	msg.Content = r(msg.Content)
+	msg.Username = r(msg.Username)
+	msg.AvatarURL = r(msg.AvatarURL)
+	msg.ThreadName = r(msg.ThreadName)
+
+	for i := range msg.Embeds {
+		e := &msg.Embeds[i]
+		e.Title = r(e.Title)
+		e.Description = r(e.Description)
+		e.URL = r(e.URL)
+		for j := range e.Fields {
+			e.Fields[j].Name = r(e.Fields[j].Name)
+			e.Fields[j].Value = r(e.Fields[j].Value)
+		}
+		if e.Footer != nil {
+			e.Footer.Text = r(e.Footer.Text)
+			e.Footer.IconURL = r(e.Footer.IconURL)
+		}
+		if e.Image != nil {
+			e.Image.URL = r(e.Image.URL)
+		}
+		if e.Thumbnail != nil {
+			e.Thumbnail.URL = r(e.Thumbnail.URL)
+		}
+		if e.Author != nil {
+			e.Author.Name = r(e.Author.Name)
+			e.Author.URL = r(e.Author.URL)
+			e.Author.IconURL = r(e.Author.IconURL)
+		}
+	}
+}
+
+// validatePayload checks the message of a payload file against the limits of
+// Discord. Unlike the default alert it is not made to fit.
+func validatePayload(msg *discord.Message) error {
+	if msg.Content == "" && len(msg.Embeds) == 0 && len(msg.Files) == 0 {
+		return errors.New("payload_file has no content, embeds or attachments")
+	}
+	if err := msg.Validate(); err != nil {
+		return fmt.Errorf("payload_file exceeds limits: %w", err)
+	}
+	return nil
+}
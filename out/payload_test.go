@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
+	"github.com/tklein1801/concourse-discord-alert-resource/discord"
+)
+
+func TestBuildPayload(t *testing.T) {
+	path := t.TempDir()
+	files := map[string]string{
+		"payload.json": `{
+			"content": "Deployed {{ .PipelineName }}",
+			"embeds": [{
+				"title": "Release",
+				"url": "https://example.com/{{ .JobName }}",
+				"image": {"url": "https://example.com/chart.png"},
+				"fields": [{"name": "Build", "value": "{{ .BuildName }}", "inline": true}]
+			}],
+			"allowed_mentions": {"parse": ["everyone"]}
+		}`,
+		"payload.yml": "username: Deployer\navatar_url: https://example.com/avatar.png\nthread_name: releases\nembeds:\n  - description: 'Vars {{ .InstanceVars }}'\n    footer:\n      text: $UNKNOWN\n",
+		"invalid.yml": "embeds: {",
+		"empty.yml":   "",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(path, name), []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	metadata := concourse.BuildMetadata{PipelineName: "demo", JobName: "test", BuildName: "1", InstanceVars: `{"env":"prod"}`}
+	none := &discord.AllowedMentions{Parse: []string{}}
+
+	cases := map[string]struct {
+		alert Alert
+		want  *discord.Message
+		err   bool
+	}{
+		"json": {
+			alert: Alert{IconURL: "https://example.com/icon.png", Roles: []string{"1"}, ThreadID: "10", PayloadFile: "payload.json"},
+			want: &discord.Message{
+				Content:         "<@&1>\nDeployed demo",
+				Username:        "Concourse",
+				AvatarURL:       "https://example.com/icon.png",
+				AllowedMentions: &discord.AllowedMentions{Parse: []string{}, Roles: []string{"1"}},
+				ThreadID:        "10",
+				Embeds: []discord.Embed{{
+					Title:  "Release",
+					URL:    "https://example.com/test",
+					Image:  &discord.Image{URL: "https://example.com/chart.png"},
+					Fields: []discord.Field{{Name: "Build", Value: "1", Inline: true}},
+				}},
+			},
+		},
+		"yaml": {
+			alert: Alert{ThreadName: "{{ .PipelineName }}", AppliedTags: []string{"5"}, PayloadFile: "payload.yml"},
+			want: &discord.Message{
+				Username:        "Deployer",
+				AvatarURL:       "https://example.com/avatar.png",
+				AllowedMentions: none,
+				ThreadName:      "releases",
+				AppliedTags:     []string{"5"},
+				Embeds: []discord.Embed{{
+					Description: `Vars {"env":"prod"}`,
+					Footer:      &discord.Footer{Text: "$UNKNOWN"},
+				}},
+			},
+		},
+		"invalid file": {
+			alert: Alert{PayloadFile: "invalid.yml"},
+			err:   true,
+		},
+		"empty file": {
+			alert: Alert{PayloadFile: "empty.yml"},
+			err:   true,
+		},
+		"missing file": {
+			alert: Alert{PayloadFile: "missing.yml"},
+			err:   true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := buildPayload(c.alert, newTemplateData(c.alert.Type, metadata, nil), path)
+			if err != nil && !c.err {
+				t.Fatalf("unexpected error from buildPayload:\n\t(ERR): %s", err)
+			} else if err == nil && c.err {
+				t.Fatalf("expected an error from buildPayload:\n\t(GOT): nil")
+			} else if err != nil && c.err {
+				return
+			}
+
+			if !cmp.Equal(got, c.want) {
+				t.Fatalf("unexpected discord.Message value from buildPayload:\n\t(GOT): %#v\n\t(WNT): %#v\n\t(DIFF): %v", got, c.want, cmp.Diff(got, c.want))
+			}
+		})
+	}
+}
+
+func TestValidatePayload(t *testing.T) {
+	cases := map[string]struct {
+		message *discord.Message
+		err     bool
+	}{
+		"content": {
+			message: &discord.Message{Content: "Deployed"},
+		},
+		"embeds": {
+			message: &discord.Message{Embeds: []discord.Embed{{Title: "Deployed"}}},
+		},
+		"empty": {
+			message: &discord.Message{Username: "Concourse"},
+			err:     true,
+		},
+		"exceeds limits": {
+			message: &discord.Message{Content: strings.Repeat("a", discord.MaxContentLength+1)},
+			err:     true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := validatePayload(c.message)
+			if err != nil && !c.err {
+				t.Fatalf("unexpected error from validatePayload:\n\t(ERR): %s", err)
+			} else if err == nil && c.err {
+				t.Fatalf("expected an error from validatePayload:\n\t(GOT): nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
+)
+
+// templateData is what the templates of an alert are rendered with, e.g.
+// {{ .PipelineName }} or {{ .Build.Duration | duration }}.
+type templateData struct {
+	concourse.BuildMetadata // Metadata of the current build
+
+	Type   string            // Alert type
+	Env    map[string]string // Environment of the put
+	Streak *streak           // Streak of still_failing and still_succeeding alerts
+	Flaky  *flakiness        // Flakiness of the job if it is flaky
+	Slow   *slowness         // Slowness of the build of slow alerts
+
+	// fetchBuild fetches the current build from Concourse. It is only called
+	// once the build is used.
+	fetchBuild func() (*concourse.Build, error)
+	once       sync.Once
+	build      *concourse.Build
+}
+
+func newTemplateData(atype string, m concourse.BuildMetadata, fetchBuild func() (*concourse.Build, error)) *templateData {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+
+	return &templateData{BuildMetadata: m, Type: atype, Env: env, fetchBuild: fetchBuild}
+}
+
+// Metadata returns the metadata of the current build, e.g. for
+// {{ .Metadata.PipelineName }}.
+func (d *templateData) Metadata() concourse.BuildMetadata {
+	return d.BuildMetadata
+}
+
+// Build returns the current build, fetched from Concourse on first use. The
+// build is empty if it cannot be fetched.
+func (d *templateData) Build() *concourse.Build {
+	d.once.Do(func() {
+		d.build = &concourse.Build{}
+		if d.fetchBuild == nil {
+			return
+		}
+
+		build, err := d.fetchBuild()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error fetching build: %v\nwill leave out its details instead\n", err)
+			return
+		}
+		d.build = build
+	})
+	return d.build
+}
+
+// CreatedBy returns the user who triggered the current build manually, taken
+// from the build if Concourse does not expose it. It is empty for builds
+// triggered otherwise.
+func (d *templateData) CreatedBy() string {
+	if d.BuildMetadata.CreatedBy != "" {
+		return d.BuildMetadata.CreatedBy
+	}
+	return d.Build().CreatedBy
+}
+
+// Duration returns how long the current build has been running, or 0 if it
+// is unknown.
+func (d *templateData) Duration() time.Duration {
+	return d.Build().DurationAt(now())
+}
+
+// templateFuncs are the functions available to templates in addition to the
+// predefined ones of text/template.
+var templateFuncs = template.FuncMap{
+	"duration": formatDuration,
+	"truncate": truncateText,
+	"escape":   escapeMarkdown,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+}
+
+// render executes the template text with data. Templates which cannot be
+// parsed or executed are reported and used as is.
+func render(name, text string, data *templateData) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing %s template: %v\nwill be used as is instead\n", name, err)
+		return text
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		fmt.Fprintf(os.Stderr, "error rendering %s template: %v\nwill be used as is instead\n", name, err)
+		return text
+	}
+	return b.String()
+}
+
+// formatDuration formats d rounded to seconds, e.g. 1h2m3s.
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+// truncateText cuts s to n characters, ending it with an ellipsis.
+func truncateText(n int, s string) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"*", `\*`,
+	"_", `\_`,
+	"~", `\~`,
+	"`", "\\`",
+	"|", `\|`,
+	">", `\>`,
+	"#", `\#`,
+	"[", `\[`,
+	"]", `\]`,
+)
+
+// escapeMarkdown escapes the markdown of Discord in s, so it is shown as is.
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tklein1801/concourse-discord-alert-resource/concourse"
+)
+
+func TestRender(t *testing.T) {
+	metadata := concourse.BuildMetadata{PipelineName: "demo", JobName: "test", BuildName: "7"}
+	build := &concourse.Build{Status: "failed", StartTime: 1792231200, EndTime: 1792231200 + 125}
+
+	cases := map[string]struct {
+		text  string
+		fetch func() (*concourse.Build, error)
+		want  string
+	}{
+		"plain text": {
+			text: "no templates",
+			want: "no templates",
+		},
+		"promoted metadata": {
+			text: "{{ .PipelineName }}/{{ .JobName }}",
+			want: "demo/test",
+		},
+		"metadata": {
+			text: "{{ .Metadata.PipelineName }}/{{ .Metadata.JobName }} #{{ .Metadata.BuildName }}",
+			want: "demo/test #7",
+		},
+		"build": {
+			text:  "{{ .Build.Status }} after {{ .Duration | duration }}",
+			fetch: func() (*concourse.Build, error) { return build, nil },
+			want:  "failed after 2m5s",
+		},
+		"build duration": {
+			text:  "took {{ .Build.Duration | duration }}",
+			fetch: func() (*concourse.Build, error) { return build, nil },
+			want:  "took 2m5s",
+		},
+		"build unavailable": {
+			text:  "{{ .Build.Status }} after {{ .Duration | duration }}",
+			fetch: func() (*concourse.Build, error) { return nil, errors.New("unauthorized") },
+			want:  " after 0s",
+		},
+		"env": {
+			text: "{{ .Env.RENDER_TEST }}",
+			want: "from env",
+		},
+		"missing env": {
+			text: "{{ .Env.RENDER_TEST_MISSING }}",
+			want: "",
+		},
+		"functions": {
+			text: `{{ "Hello" | upper }} {{ "World" | lower }} {{ truncate 5 "truncated" }} {{ escape "*bold* [x]" }}`,
+			want: `HELLO world trun… \*bold\* \[x\]`,
+		},
+		"invalid template": {
+			text: "{{ .Type ",
+			want: "{{ .Type ",
+		},
+		"failing template": {
+			text: "{{ .Unknown }}",
+			want: "{{ .Unknown }}",
+		},
+	}
+
+	t.Setenv("RENDER_TEST", "from env")
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := render("test", c.text, newTemplateData("failed", metadata, c.fetch))
+			if got != c.want {
+				t.Fatalf("unexpected string from render:\n\t(GOT): %q\n\t(WNT): %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                       "0s",
+		1500 * time.Millisecond: "2s",
+		95 * time.Second:        "1m35s",
+		time.Hour + time.Second: "1h0m1s",
+	}
+
+	for d, want := range cases {
+		if got := formatDuration(d); got != want {
+			t.Fatalf("unexpected string from formatDuration(%d):\n\t(GOT): %q\n\t(WNT): %q", d, got, want)
+		}
+	}
+}